@@ -1,10 +1,15 @@
 package main
 
 import (
+	"log"
+	"os"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
 	"github.com/mdesmet/go-dbt/pkg/dbt"
 )
 
 func main() {
+	log.SetOutput(config.NewScrubbingWriter(os.Stderr))
 	rootCmd := dbt.RootCommand()
 	rootCmd.Execute()
 }
@@ -1,11 +1,13 @@
 module github.com/mdesmet/go-dbt
 
-go 1.15
+go 1.16
 
 require (
 	github.com/flosch/pongo2/v4 v4.0.2
+	github.com/google/uuid v1.1.1
 	github.com/snowflakedb/gosnowflake v1.4.2
 	github.com/spf13/cobra v1.1.3
+	github.com/spf13/pflag v1.0.5
 	github.com/youmark/pkcs8 v0.0.0-20201027041543-1326539a0a0a
-	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
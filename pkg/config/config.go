@@ -4,26 +4,133 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"path/filepath"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Name    string
-	Profile string
-	Models  map[string]interface{} // TODO: this should definitely be improved
+	Name                string `required:"true"`
+	Version             string
+	ConfigVersion       int         `yaml:"config-version"`
+	Profile             string      `required:"true"`
+	ModelPaths          []string    `yaml:"model-paths"`
+	SourcePaths         []string    `yaml:"source-paths"` // deprecated, replaced by model-paths
+	SeedPaths           []string    `yaml:"seed-paths"`
+	DataPaths           []string    `yaml:"data-paths"` // deprecated, replaced by seed-paths
+	TestPaths           []string    `yaml:"test-paths"`
+	AnalysisPaths       []string    `yaml:"analysis-paths"`
+	MacroPaths          []string    `yaml:"macro-paths"`
+	SnapshotPaths       []string    `yaml:"snapshot-paths"`
+	DocsPaths           []string    `yaml:"docs-paths"`
+	AssetPaths          []string    `yaml:"asset-paths"`
+	TargetPath          string      `yaml:"target-path"`
+	LogPath             string      `yaml:"log-path"`
+	PackagesInstallPath string      `yaml:"packages-install-path"`
+	ModulesPath         string      `yaml:"modules-path"` // deprecated, replaced by packages-install-path
+	CleanTargets        []string    `yaml:"clean-targets"`
+	RequireDbtVersion   interface{} `yaml:"require-dbt-version"`
+	Quoting             map[string]bool
+	Models              map[string]interface{} // TODO: this should definitely be improved
+	Seeds               map[string]interface{}
+	Snapshots           map[string]interface{}
+	Sources             map[string]interface{}
+	Tests               map[string]interface{}
+	Vars                map[string]interface{}
+	OnRunStart          Hooks         `yaml:"on-run-start"`
+	OnRunEnd            Hooks         `yaml:"on-run-end"`
+	QueryComment        *QueryComment `yaml:"query-comment"` // nil when not configured
 }
 
-func ReadConfig() Config {
-	configFile, err := ioutil.ReadFile("dbt_project.yml")
+// QueryComment is the comment added to every statement of a node, written in YAML as either the
+// comment or {comment: ..., append: true}. An empty comment disables it.
+type QueryComment struct {
+	Comment string
+	Append  bool // add the comment after the statement rather than before it
+}
+
+func (queryComment *QueryComment) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*queryComment = QueryComment{Comment: value.Value}
+		return nil
+	}
+	parsed := struct {
+		Comment string
+		Append  bool
+	}{}
+	err := value.Decode(&parsed)
 	if err != nil {
-		log.Fatalf("Could not read the config file")
+		return fmt.Errorf("line %d: query-comment should be a string or e.g. {comment: ..., append: true}", value.Line)
 	}
-	config := Config{}
-	err = yaml.Unmarshal(configFile, &config)
+	*queryComment = QueryComment(parsed)
+	return nil
+}
+
+// Hooks are SQL statements, written in YAML as either a single string or a list.
+type Hooks []string
+
+func (hooks *Hooks) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*hooks = Hooks{value.Value}
+		return nil
+	}
+	var list []string
+	err := value.Decode(&list)
 	if err != nil {
-		log.Fatalf("error: %v", err)
+		return fmt.Errorf("line %d: hooks should be a string or a list of strings", value.Line)
 	}
-	fmt.Printf("--- config:\n%v\n\n", config)
+	*hooks = list
+	return nil
+}
+
+func ReadConfig(projectDir string) Config {
+	config, err := LoadConfig(projectDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(Stdout, "--- config:\n%v\n\n", config)
 	return config
 }
+
+// LoadConfig reads dbt_project.yml from projectDir, returning an error instead of bailing out.
+func LoadConfig(projectDir string) (Config, error) {
+	path := filepath.Join(projectDir, "dbt_project.yml")
+	configFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("Could not read the config file %s", path)
+	}
+	config := Config{}
+	err = loadRenderedYAML(path, configFile, &config)
+	if err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// Deprecations lists the deprecated settings used in dbt_project.yml.
+func (config Config) Deprecations() []string {
+	deprecations := make([]string, 0)
+	if len(config.SourcePaths) > 0 {
+		deprecations = append(deprecations, "'source-paths' is deprecated, use 'model-paths' instead")
+	}
+	if len(config.DataPaths) > 0 {
+		deprecations = append(deprecations, "'data-paths' is deprecated, use 'seed-paths' instead")
+	}
+	if config.ModulesPath != "" {
+		deprecations = append(deprecations, "'modules-path' is deprecated, use 'packages-install-path' instead")
+	}
+	return deprecations
+}
+
+// ReadVars parses the value of the --vars flag, which can be either a YAML or a JSON dictionary.
+func ReadVars(vars string) map[string]interface{} {
+	parsedVars := make(map[string]interface{})
+	if vars == "" {
+		return parsedVars
+	}
+	err := yaml.Unmarshal([]byte(vars), &parsedVars)
+	if err != nil {
+		log.Fatalf("Could not parse --vars, expected a YAML dictionary: %v", err)
+	}
+	return parsedVars
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Package is a dependency of the project, installed from either a local path or a git repository.
+type Package struct {
+	Local        string
+	Git          string
+	Revision     string
+	Subdirectory string
+}
+
+type Packages struct {
+	Packages []Package
+}
+
+// LoadPackages reads packages.yml from projectDir, a missing file means the project has no dependencies.
+func LoadPackages(projectDir string) (Packages, error) {
+	path := filepath.Join(projectDir, "packages.yml")
+	packagesFile, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Packages{}, nil
+	}
+	if err != nil {
+		return Packages{}, fmt.Errorf("Could not read the packages file %s", path)
+	}
+	packages := Packages{}
+	err = loadRenderedYAML(path, packagesFile, &packages)
+	if err != nil {
+		return Packages{}, err
+	}
+	for _, dependency := range packages.Packages {
+		if (dependency.Local == "") == (dependency.Git == "") {
+			return Packages{}, fmt.Errorf("%s: every package needs either a 'local' or a 'git' location", path)
+		}
+	}
+	return packages, nil
+}
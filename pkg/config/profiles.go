@@ -4,41 +4,210 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-
-	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
 type Connection struct {
-	Adapter                string `yaml:"type"`
+	Adapter                string `yaml:"type" required:"true"`
 	Threads                int
 	Account                string
 	User                   string
+	Authenticator          string // snowflake (password), oauth, externalbrowser, jwt or an Okta URL, by default jwt when a private key is set
 	Password               string
+	Token                  string // the OAuth access token
+	PrivateKey             string `yaml:"private_key"` // the PEM or base64 encoded DER content of the private key
 	PrivateKeyPath         string `yaml:"private_key_path"`
-	PrivateKeyPassphrase   string `yaml:"private_key_passphrase"`
+	PrivateKeyPassphrase   string `yaml:"private_key_passphrase"` // only for encrypted private keys
 	Database               string
 	Role                   string
 	Warehouse              string
 	Schema                 string
-	ClientSessionKeepAlive bool `yaml:"client_session_keep_alive"`
+	ClientSessionKeepAlive bool   `yaml:"client_session_keep_alive"`
+	Retries                int    // how often a model is retried after a transient error
+	RetryDelay             int    `yaml:"retry_delay"`   // the seconds before the first retry (default 1), doubling with every retry
+	QueryTimeout           int    `yaml:"query_timeout"` // the seconds a statement may take, zero means no timeout
+	QueryTag               string `yaml:"query_tag"`     // set on every session, shows up in the query history
+	Timezone               string
+	SessionParameters      map[string]string `yaml:"session_parameters"` // other parameters set on every session
 }
 type Connections struct {
-	Outputs map[string]Connection
-	Target  string
+	Outputs map[string]Connection `required:"true"`
+	Target  string                `required:"true"`
 }
 
 type Profiles map[string]Connections
 
-func ReadProfiles() Profiles {
-	configFile, err := ioutil.ReadFile("profiles.yml")
-	if err != nil {
-		log.Fatalf("Could not read the profiles file")
+// profilesFile is profiles.yml, which can have global settings in a config block next to the profiles.
+type profilesFile struct {
+	Config   map[string]interface{}
+	Profiles Profiles `yaml:",inline"`
+}
+
+// FindProfilesDir returns the directory containing profiles.yml. An explicit --profiles-dir takes precedence
+// over DBT_PROFILES_DIR, followed by the project directory and finally ~/.dbt.
+func FindProfilesDir(profilesDir string, projectDir string) string {
+	if profilesDir != "" {
+		return profilesDir
+	}
+	if envDir := os.Getenv("DBT_PROFILES_DIR"); envDir != "" {
+		return envDir
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, "profiles.yml")); err == nil {
+		return projectDir
 	}
-	profiles := Profiles{}
-	err = yaml.Unmarshal(configFile, &profiles)
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".dbt")
+	}
+	return projectDir
+}
+
+func ReadProfiles(profilesDir string) Profiles {
+	profiles, err := LoadProfiles(profilesDir)
 	if err != nil {
-		log.Fatalf("error: %v", err)
+		log.Fatal(err)
 	}
-	fmt.Printf("--- config:\n%v\n\n", profiles)
+	fmt.Fprintf(Stdout, "--- config:\n%v\n\n", profiles.Masked())
 	return profiles
 }
+
+// LoadProfiles reads profiles.yml from profilesDir, returning an error instead of bailing out.
+func LoadProfiles(profilesDir string) (Profiles, error) {
+	path := filepath.Join(profilesDir, "profiles.yml")
+	configFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read the profiles file %s", path)
+	}
+	file := profilesFile{Profiles: Profiles{}}
+	err = loadRenderedYAML(path, configFile, &file)
+	if err != nil {
+		return nil, err
+	}
+	return file.Profiles, nil
+}
+
+// Connection returns the connection of the requested target, or the profile's default target when target is empty.
+func (profiles Profiles) Connection(profile string, target string) (*Connection, error) {
+	connections, seen := profiles[profile]
+	if !seen {
+		available := make([]string, 0)
+		for name := range profiles {
+			available = append(available, name)
+		}
+		sort.Strings(available)
+		return nil, fmt.Errorf("Could not find profile named '%s', available profiles: %s", profile, strings.Join(available, ", "))
+	}
+	if target == "" {
+		target = connections.Target
+	}
+	connection, seen := connections.Outputs[target]
+	if !seen {
+		available := make([]string, 0)
+		for name := range connections.Outputs {
+			available = append(available, name)
+		}
+		sort.Strings(available)
+		return nil, fmt.Errorf("The profile '%s' does not have a target named '%s', available targets: %s", profile, target, strings.Join(available, ", "))
+	}
+	return &connection, nil
+}
+
+// Validate returns all problems found in the connection settings.
+func (connection Connection) Validate() []error {
+	errors := make([]error, 0)
+	if connection.Adapter != "snowflake" {
+		errors = append(errors, fmt.Errorf("profiles.yml: unsupported adapter type '%s'", connection.Adapter))
+	}
+	if connection.Account == "" || connection.User == "" {
+		errors = append(errors, fmt.Errorf("profiles.yml: 'account' and 'user' are required for snowflake"))
+	}
+	errors = append(errors, connection.validateAuthentication()...)
+	if connection.Threads < 1 {
+		errors = append(errors, fmt.Errorf("profiles.yml: 'threads' should be at least 1"))
+	}
+	if connection.Retries < 0 || connection.RetryDelay < 0 || connection.QueryTimeout < 0 {
+		errors = append(errors, fmt.Errorf("profiles.yml: 'retries', 'retry_delay' and 'query_timeout' can't be negative"))
+	}
+	return errors
+}
+
+// AuthenticatorName returns the authenticator, which defaults to jwt with a private key and to password authentication otherwise.
+// The keywords are lowercased, an Okta URL is returned as is, as its path is case sensitive.
+func (connection Connection) AuthenticatorName() string {
+	authenticator := strings.ToLower(connection.Authenticator)
+	switch {
+	case authenticator == "snowflake_jwt":
+		return "jwt"
+	case strings.HasPrefix(authenticator, "https://"):
+		return connection.Authenticator
+	case authenticator != "":
+		return authenticator
+	case connection.PrivateKey != "" || connection.PrivateKeyPath != "":
+		return "jwt"
+	default:
+		return "snowflake"
+	}
+}
+
+func (connection Connection) validateAuthentication() []error {
+	errors := make([]error, 0)
+	hasKey := connection.PrivateKey != "" || connection.PrivateKeyPath != ""
+	authenticator := connection.AuthenticatorName()
+	switch {
+	case authenticator == "snowflake":
+		if connection.Password == "" {
+			errors = append(errors, fmt.Errorf("profiles.yml: 'password' is required, or set 'private_key_path', 'private_key' or another 'authenticator'"))
+		}
+	case authenticator == "jwt":
+		if !hasKey {
+			errors = append(errors, fmt.Errorf("profiles.yml: the jwt authenticator requires 'private_key_path' or 'private_key'"))
+		}
+	case authenticator == "oauth":
+		if connection.Token == "" {
+			errors = append(errors, fmt.Errorf("profiles.yml: the oauth authenticator requires a 'token'"))
+		}
+	case authenticator == "externalbrowser":
+	case strings.HasPrefix(strings.ToLower(authenticator), "https://"):
+		if connection.Password == "" {
+			errors = append(errors, fmt.Errorf("profiles.yml: authenticating with Okta requires a 'password'"))
+		}
+	default:
+		errors = append(errors, fmt.Errorf("profiles.yml: unsupported authenticator '%s', expected snowflake, oauth, externalbrowser, jwt or an Okta URL", connection.Authenticator))
+	}
+	if connection.PrivateKey != "" && connection.PrivateKeyPath != "" {
+		errors = append(errors, fmt.Errorf("profiles.yml: set either 'private_key' or 'private_key_path', not both"))
+	}
+	return errors
+}
+
+// Masked returns a printable copy of all profiles with all credentials hidden.
+func (profiles Profiles) Masked() Profiles {
+	masked := make(Profiles, len(profiles))
+	for name, connections := range profiles {
+		outputs := make(map[string]Connection, len(connections.Outputs))
+		for target, connection := range connections.Outputs {
+			outputs[target] = connection.Masked()
+		}
+		masked[name] = Connections{Outputs: outputs, Target: connections.Target}
+	}
+	return masked
+}
+
+// Masked returns a printable copy of the connection with all credentials hidden.
+func (connection Connection) Masked() Connection {
+	if connection.Password != "" {
+		connection.Password = secretMask
+	}
+	if connection.PrivateKeyPassphrase != "" {
+		connection.PrivateKeyPassphrase = secretMask
+	}
+	if connection.Token != "" {
+		connection.Token = secretMask
+	}
+	if connection.PrivateKey != "" {
+		connection.PrivateKey = secretMask
+	}
+	return connection
+}
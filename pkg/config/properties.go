@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+)
+
+type Quoting struct {
+	Database   *bool
+	Schema     *bool
+	Identifier *bool
+}
+
+type FreshnessThreshold struct {
+	Count  int    `required:"true"`
+	Period string `required:"true"` // minute, hour or day
+}
+
+type Freshness struct {
+	WarnAfter  *FreshnessThreshold `yaml:"warn_after"`
+	ErrorAfter *FreshnessThreshold `yaml:"error_after"`
+	Filter     string
+}
+
+type SourceTable struct {
+	Name          string `required:"true"`
+	Identifier    string
+	Description   string
+	Database      string
+	Schema        string
+	Quoting       Quoting
+	LoadedAtField string `yaml:"loaded_at_field"`
+	Freshness     *Freshness
+	Meta          map[string]interface{}
+	Tags          []string
+	Columns       []ColumnProperties
+	Tests         []interface{}
+}
+
+type Source struct {
+	Name          string `required:"true"`
+	Description   string
+	Database      string
+	Schema        string
+	Loader        string
+	Quoting       Quoting
+	LoadedAtField string `yaml:"loaded_at_field"`
+	Freshness     *Freshness
+	Meta          map[string]interface{}
+	Tags          []string
+	Tables        []SourceTable
+}
+
+// Constraint is a constraint of a model contract, set on a column or, with Columns, on the model.
+type Constraint struct {
+	Type       string `required:"true"` // not_null, primary_key, unique, check or foreign_key
+	Name       string
+	Expression string   // the condition of a check constraint
+	Columns    []string // only for model level constraints
+	To         string   // the relation referenced by a foreign key, e.g. ref('customers')
+	ToColumns  []string `yaml:"to_columns"`
+}
+
+type ColumnProperties struct {
+	Name        string `required:"true"`
+	Description string
+	DataType    string `yaml:"data_type"`
+	Constraints []Constraint
+	Meta        map[string]interface{}
+	Quote       bool
+	Tags        []string
+	Tests       []interface{}
+}
+
+type Docs struct {
+	Show      *bool
+	NodeColor string `yaml:"node_color"`
+}
+
+// Visible tells whether the node should be shown in the documentation, which is the default.
+func (docs Docs) Visible() bool {
+	return docs.Show == nil || *docs.Show
+}
+
+// NodeProperties describes a model, seed or snapshot in a property file.
+type NodeProperties struct {
+	Name        string `required:"true"`
+	Description string
+	Docs        *Docs
+	Config      map[string]interface{}
+	Constraints []Constraint
+	Meta        map[string]interface{}
+	Tags        []string
+	Columns     []ColumnProperties
+	Tests       []interface{}
+}
+
+type ExposureOwner struct {
+	Name  string
+	Email string `required:"true"`
+}
+
+type Exposure struct {
+	Name        string        `required:"true"`
+	Type        string        `required:"true"`
+	Owner       ExposureOwner `required:"true"`
+	Label       string
+	Description string
+	Url         string
+	Maturity    string
+	DependsOn   []string `yaml:"depends_on"`
+	Meta        map[string]interface{}
+	Tags        []string
+}
+
+// Properties is the content of a property file (a .yml file next to the models).
+type Properties struct {
+	Version   int
+	Models    []NodeProperties
+	Seeds     []NodeProperties
+	Snapshots []NodeProperties
+	Sources   []Source
+	Exposures []Exposure
+}
+
+func ReadProperties(path string) Properties {
+	properties, err := LoadProperties(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(Stdout, "--- config:\n%v\n\n", properties)
+	return properties
+}
+
+// LoadProperties reads a property file, returning an error instead of bailing out.
+func LoadProperties(path string) (Properties, error) {
+	propertiesFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Properties{}, fmt.Errorf("Could not read the property file %s", path)
+	}
+	properties := Properties{}
+	err = loadYAML(path, propertiesFile, &properties)
+	if err != nil {
+		return Properties{}, err
+	}
+	return properties, nil
+}
+
+// Validate checks the type of the constraint and the settings that go with it.
+func (constraint Constraint) Validate() error {
+	switch constraint.Type {
+	case "not_null", "primary_key", "unique":
+	case "check":
+		if constraint.Expression == "" {
+			return fmt.Errorf("A check constraint needs an expression")
+		}
+	case "foreign_key":
+		if constraint.To == "" {
+			return fmt.Errorf("A foreign_key constraint needs the relation it refers to in 'to'")
+		}
+	default:
+		return fmt.Errorf("Invalid constraint type '%s', expected not_null, primary_key, unique, check or foreign_key", constraint.Type)
+	}
+	return nil
+}
+
+// Duration converts the threshold to a duration.
+func (threshold FreshnessThreshold) Duration() (time.Duration, error) {
+	switch threshold.Period {
+	case "minute":
+		return time.Duration(threshold.Count) * time.Minute, nil
+	case "hour":
+		return time.Duration(threshold.Count) * time.Hour, nil
+	case "day":
+		return time.Duration(threshold.Count) * 24 * time.Hour, nil
+	default:
+		return 0, fmt.Errorf("Invalid freshness period '%s', expected minute, hour or day", threshold.Period)
+	}
+}
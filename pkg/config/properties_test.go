@@ -0,0 +1,20 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFreshnessThresholdDuration(t *testing.T) {
+	duration, err := FreshnessThreshold{Count: 12, Period: "hour"}.Duration()
+	if err != nil || duration != 12*time.Hour {
+		t.Error(duration, err)
+	}
+	duration, err = FreshnessThreshold{Count: 2, Period: "day"}.Duration()
+	if err != nil || duration != 48*time.Hour {
+		t.Error(duration, err)
+	}
+	if _, err = (FreshnessThreshold{Count: 1, Period: "week"}).Duration(); err == nil {
+		t.Error()
+	}
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaError describes a single problem in a YAML file, pointing to the offending line and column.
+type SchemaError struct {
+	Path    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e SchemaError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Path, e.Line, e.Column, e.Message)
+}
+
+// ValidationErrors bundles all problems found while loading a file.
+type ValidationErrors []error
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// inlineMapKey is the key of a map field tagged with `yaml:",inline"`, which takes all keys that are not a field.
+const inlineMapKey = ",inline"
+
+// loadYAML validates content against the shape of out, and only unmarshals it when no problems were found.
+// Struct fields tagged with `required:"true"` have to be present.
+func loadYAML(path string, content []byte, out interface{}) error {
+	return decodeYAML(path, content, out, false)
+}
+
+// loadRenderedYAML is loadYAML for files that can use env_var() in their values.
+func loadRenderedYAML(path string, content []byte, out interface{}) error {
+	return decodeYAML(path, content, out, true)
+}
+
+func decodeYAML(path string, content []byte, out interface{}, render bool) error {
+	var document yaml.Node
+	err := yaml.Unmarshal(content, &document)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if len(document.Content) == 0 {
+		return nil
+	}
+	if render {
+		err = renderNode(path, &document)
+		if err != nil {
+			return err
+		}
+	}
+	root := document.Content[0]
+	errs := validateNode(path, root, reflect.TypeOf(out).Elem(), "")
+	if len(errs) > 0 {
+		return errs
+	}
+	err = root.Decode(out)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+func validateNode(path string, node *yaml.Node, t reflect.Type, name string) ValidationErrors {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.ShortTag() == "!!null" {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		// the type knows best how to unmarshal itself
+		return nil
+	}
+
+	schemaError := func(node *yaml.Node, format string, args ...interface{}) ValidationErrors {
+		message := fmt.Sprintf(format, args...)
+		if name != "" {
+			message = fmt.Sprintf("%s (in '%s')", message, name)
+		}
+		return ValidationErrors{SchemaError{Path: path, Line: node.Line, Column: node.Column, Message: message}}
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return nil
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return schemaError(node, "expected a mapping but found %s", describeNode(node))
+		}
+		return validateStruct(path, node, t, name)
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return schemaError(node, "expected a mapping but found %s", describeNode(node))
+		}
+		errs := ValidationErrors{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			errs = append(errs, validateNode(path, node.Content[i+1], t.Elem(), joinName(name, node.Content[i].Value))...)
+		}
+		return errs
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return schemaError(node, "expected a list but found %s", describeNode(node))
+		}
+		errs := ValidationErrors{}
+		for i, item := range node.Content {
+			errs = append(errs, validateNode(path, item, t.Elem(), fmt.Sprintf("%s[%d]", name, i))...)
+		}
+		return errs
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			return schemaError(node, "expected a string but found %s", describeNode(node))
+		}
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!bool" {
+			return schemaError(node, "expected a boolean but found %s", describeNode(node))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!int" {
+			return schemaError(node, "expected an integer but found %s", describeNode(node))
+		}
+	case reflect.Float32, reflect.Float64:
+		if node.Kind != yaml.ScalarNode || (node.ShortTag() != "!!int" && node.ShortTag() != "!!float") {
+			return schemaError(node, "expected a number but found %s", describeNode(node))
+		}
+	}
+	return nil
+}
+
+func validateStruct(path string, node *yaml.Node, t reflect.Type, name string) ValidationErrors {
+	errs := ValidationErrors{}
+	fields := make(map[string]reflect.StructField)
+	collectFields(t, fields)
+
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		field, known := fields[key.Value]
+		if inlineMap, inline := fields[inlineMapKey]; !known && inline {
+			errs = append(errs, validateNode(path, node.Content[i+1], inlineMap.Type.Elem(), joinName(name, key.Value))...)
+			continue
+		}
+		if !known {
+			message := fmt.Sprintf("unknown field '%s'", key.Value)
+			if name != "" {
+				message = fmt.Sprintf("%s (in '%s')", message, name)
+			}
+			errs = append(errs, SchemaError{Path: path, Line: key.Line, Column: key.Column, Message: message})
+			continue
+		}
+		seen[key.Value] = true
+		errs = append(errs, validateNode(path, node.Content[i+1], field.Type, joinName(name, key.Value))...)
+	}
+
+	// sorted, so that the problems are always reported in the same order
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if fields[key].Tag.Get("required") == "true" && !seen[key] {
+			message := fmt.Sprintf("missing required field '%s'", key)
+			if name != "" {
+				message = fmt.Sprintf("%s (in '%s')", message, name)
+			}
+			errs = append(errs, SchemaError{Path: path, Line: node.Line, Column: node.Column, Message: message})
+		}
+	}
+	return errs
+}
+
+// collectFields maps the YAML keys of a struct to its fields, following the same rules as yaml.v3.
+func collectFields(t reflect.Type, fields map[string]reflect.StructField) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		if len(tag) > 1 && tag[1] == "inline" && field.Type.Kind() == reflect.Struct {
+			collectFields(field.Type, fields)
+			continue
+		}
+		if len(tag) > 1 && tag[1] == "inline" && field.Type.Kind() == reflect.Map {
+			fields[inlineMapKey] = field
+			continue
+		}
+		key := tag[0]
+		if key == "" {
+			key = strings.ToLower(field.Name)
+		}
+		fields[key] = field
+	}
+}
+
+func joinName(name string, key string) string {
+	if name == "" {
+		return key
+	}
+	return name + "." + key
+}
+
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	default:
+		return fmt.Sprintf("'%s'", node.Value)
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadYAMLReportsProblemsWithPositions(t *testing.T) {
+	content := `
+models:
+  - name: orders
+    descripton: typo
+    columns:
+      - name: id
+        quote: maybe
+  - description: no name
+`
+	properties := Properties{}
+	err := loadYAML("models/schema.yml", []byte(content), &properties)
+	if err == nil {
+		t.Fatal()
+	}
+	expected := []string{
+		"models/schema.yml:4:5: unknown field 'descripton' (in 'models[0]')",
+		"models/schema.yml:7:16: expected a boolean but found 'maybe' (in 'models[0].columns[0].quote')",
+		"models/schema.yml:8:5: missing required field 'name' (in 'models[1]')",
+	}
+	if err.Error() != strings.Join(expected, "\n") {
+		t.Error(err)
+	}
+}
+
+func TestLoadYAMLUnmarshalsValidContent(t *testing.T) {
+	content := `
+name: demo
+profile: demo
+config-version: 2
+vars:
+  start_date: '2021-01-01'
+`
+	config := Config{}
+	err := loadYAML("dbt_project.yml", []byte(content), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Name != "demo" || config.ConfigVersion != 2 || config.Vars["start_date"] != "2021-01-01" {
+		t.Error(config)
+	}
+}
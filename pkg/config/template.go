@@ -0,0 +1,125 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/flosch/pongo2/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables starting with this prefix are considered secrets and are scrubbed from the output.
+const SecretEnvPrefix = "DBT_ENV_SECRET_"
+
+const secretMask = "*****"
+
+func init() {
+	// neither YAML nor SQL should ever be HTML escaped
+	pongo2.SetAutoescape(false)
+}
+
+// Hooks and the query comment are rendered when they are executed, as they can use the context of the model or the run.
+var unrenderedKeys = map[string]bool{
+	"pre-hook":      true,
+	"post-hook":     true,
+	"pre_hook":      true,
+	"post_hook":     true,
+	"+pre-hook":     true,
+	"+post-hook":    true,
+	"+pre_hook":     true,
+	"+post_hook":    true,
+	"on-run-start":  true,
+	"on-run-end":    true,
+	"query-comment": true,
+}
+
+// renderNode renders every string in a YAML document as a template before it gets unmarshalled.
+func renderNode(path string, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			if err := renderNode(path, child); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if unrenderedKeys[node.Content[i].Value] {
+				continue
+			}
+			if err := renderNode(path, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "{{") && !strings.Contains(node.Value, "{%") {
+			return nil
+		}
+		tpl, err := pongo2.FromString(node.Value)
+		if err != nil {
+			return fmt.Errorf("%s:%d:%d: Could not parse template: %v", path, node.Line, node.Column, err)
+		}
+		rendered, err := tpl.Execute(pongo2.Context{
+			"env_var": EnvVar,
+		})
+		if err != nil {
+			return fmt.Errorf("%s:%d:%d: Could not render template: %v", path, node.Line, node.Column, err)
+		}
+		// let YAML resolve the type of the rendered value, e.g. threads: "{{ env_var('THREADS') }}"
+		node.Value = rendered
+		node.Tag = ""
+		node.Style = 0
+	}
+	return nil
+}
+
+// EnvVar returns the value of an environment variable, falling back to the default when it isn't set.
+func EnvVar(name string, defaultValue ...string) (string, error) {
+	if value, set := os.LookupEnv(name); set {
+		return value, nil
+	}
+	if len(defaultValue) > 0 {
+		return defaultValue[0], nil
+	}
+	return "", fmt.Errorf("Env var required but not provided: '%s'", name)
+}
+
+// Stdout is the standard output with all secrets scrubbed, everything that gets printed goes through it as
+// compiled SQL and configuration can contain secrets.
+var Stdout = NewScrubbingWriter(os.Stdout)
+
+// Scrub masks the values of all secret environment variables in s, also in their JSON encoded form as used
+// in the artifacts.
+func Scrub(s string) string {
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, SecretEnvPrefix) {
+			continue
+		}
+		value := env[strings.Index(env, "=")+1:]
+		if value == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, value, secretMask)
+		if encoded, err := json.Marshal(value); err == nil {
+			s = strings.ReplaceAll(s, string(encoded[1:len(encoded)-1]), secretMask)
+		}
+	}
+	return s
+}
+
+type scrubbingWriter struct {
+	out io.Writer
+}
+
+// NewScrubbingWriter wraps out so that secret values never get written to it.
+func NewScrubbingWriter(out io.Writer) io.Writer {
+	return scrubbingWriter{out: out}
+}
+
+func (w scrubbingWriter) Write(p []byte) (int, error) {
+	_, err := io.WriteString(w.out, Scrub(string(p)))
+	return len(p), err
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoadRenderedYAMLUsesEnvVarsAndDefaults(t *testing.T) {
+	os.Setenv("GO_DBT_TEST_USER", "alice")
+	os.Setenv("GO_DBT_TEST_THREADS", "4")
+	defer os.Unsetenv("GO_DBT_TEST_USER")
+	defer os.Unsetenv("GO_DBT_TEST_THREADS")
+
+	content := `
+user: "{{ env_var('GO_DBT_TEST_USER') }}"
+role: "{{ env_var('GO_DBT_TEST_ROLE', 'analyst') }}"
+threads: "{{ env_var('GO_DBT_TEST_THREADS') }}"
+type: snowflake
+`
+	connection := Connection{}
+	err := loadRenderedYAML("profiles.yml", []byte(content), &connection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connection.User != "alice" || connection.Role != "analyst" || connection.Threads != 4 {
+		t.Error(connection)
+	}
+}
+
+func TestLoadRenderedYAMLFailsOnMissingEnvVar(t *testing.T) {
+	connection := Connection{}
+	err := loadRenderedYAML("profiles.yml", []byte("type: snowflake\nuser: \"{{ env_var('GO_DBT_TEST_MISSING') }}\""), &connection)
+	if err == nil {
+		t.Error()
+	}
+}
+
+func TestLoadRenderedYAMLLeavesHooksUnrendered(t *testing.T) {
+	content := `
+name: demo
+profile: demo
+on-run-start: "grant usage on schema {{ target.schema }} to role reporter"
+`
+	config := Config{}
+	err := loadRenderedYAML("dbt_project.yml", []byte(content), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.OnRunStart) != 1 || config.OnRunStart[0] != "grant usage on schema {{ target.schema }} to role reporter" {
+		t.Error(config.OnRunStart)
+	}
+}
+
+func TestScrubMasksSecretEnvVars(t *testing.T) {
+	os.Setenv(SecretEnvPrefix+"PASSWORD", "hunter2")
+	defer os.Unsetenv(SecretEnvPrefix + "PASSWORD")
+
+	if Scrub("password=hunter2") != "password=*****" {
+		t.Error()
+	}
+}
+
+func TestScrubMasksJSONEncodedSecrets(t *testing.T) {
+	os.Setenv(SecretEnvPrefix+"TOKEN", `a"b\c<d>&e`)
+	defer os.Unsetenv(SecretEnvPrefix + "TOKEN")
+
+	encoded, _ := json.Marshal(map[string]string{"sql": `select 'a"b\c<d>&e'`})
+	if scrubbed := Scrub(string(encoded)); scrubbed != `{"sql":"select '*****'"}` {
+		t.Error(scrubbed)
+	}
+	var out strings.Builder
+	fmt.Fprintln(NewScrubbingWriter(&out), "Going to execute SQL", `select 'a"b\c<d>&e'`)
+	if out.String() != "Going to execute SQL select '*****'\n" {
+		t.Error(out.String())
+	}
+}
@@ -1,12 +1,21 @@
 package dag
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
+
+// SourcePrefix is the prefix of vertices representing sources, e.g. source:package.name.table
+const SourcePrefix = "source:"
+
+// TagPrefix is the prefix of selectors matching all vertices with a tag, e.g. tag:nightly
+const TagPrefix = "tag:"
 
 /*
 	Select all nodes without any parents and add to queue
 	Start processing the queue
 	Once a node is finished, remove it from the Dag and add all nodes without parents to the queue
-	Order the queue based on the int (for now always the number of descendants/parents)
+	Order the queue based on the critical path of the nodes (see CriticalPaths)
 	Execute until no nodes left
 */
 
@@ -14,8 +23,9 @@ type EdgeWalkFunc func(v string) map[string]int
 
 type Dag struct {
 	vertices  map[string]bool
-	upEdges   map[string]map[string]int // the direct ancestors
-	downEdges map[string]map[string]int // the direct descendants
+	upEdges   map[string]map[string]int  // the direct ancestors
+	downEdges map[string]map[string]int  // the direct descendants
+	tags      map[string]map[string]bool // the vertices by tag
 }
 
 func CreateDag() *Dag {
@@ -23,14 +33,35 @@ func CreateDag() *Dag {
 		vertices:  make(map[string]bool),
 		upEdges:   make(map[string]map[string]int),
 		downEdges: make(map[string]map[string]int),
+		tags:      make(map[string]map[string]bool),
 	}
 	return &dag
 }
 
+// AddTag tags a vertex, so that it is selected by tag:name.
+func (dag *Dag) AddTag(vertex string, tag string) {
+	if _, seen := dag.tags[tag]; !seen {
+		dag.tags[tag] = make(map[string]bool)
+	}
+	dag.tags[tag][vertex] = true
+}
+
 func (dag *Dag) Len() int {
 	return len(dag.vertices)
 }
 
+func (dag *Dag) Vertices() []string {
+	vertices := make([]string, 0, len(dag.vertices))
+	for vertex := range dag.vertices {
+		vertices = append(vertices, vertex)
+	}
+	return vertices
+}
+
+func (dag *Dag) Contains(vertex string) bool {
+	return dag.vertices[vertex]
+}
+
 func (dag *Dag) Valid() bool {
 	visited := make(map[string]bool)
 	recStack := make(map[string]bool)
@@ -111,6 +142,31 @@ func (dag *Dag) Ancestors(v string) map[string]bool {
 	return dag.recursivelyFindEdges(ancestors, seenEdges, dag.walkUp(v), dag.walkUp)
 }
 
+// CriticalPaths returns for every vertex the heaviest path from the vertex down to a leaf, including
+// the weight of the vertex itself. Running the vertices with the longest critical path first
+// shortens the total run time.
+func (dag *Dag) CriticalPaths(weight func(v string) float64) map[string]float64 {
+	paths := make(map[string]float64, len(dag.vertices))
+	var criticalPath func(v string) float64
+	criticalPath = func(v string) float64 {
+		if path, seen := paths[v]; seen {
+			return path
+		}
+		longest := 0.0
+		for child := range dag.downEdges[v] {
+			if path := criticalPath(child); path > longest {
+				longest = path
+			}
+		}
+		paths[v] = weight(v) + longest
+		return paths[v]
+	}
+	for vertex := range dag.vertices {
+		criticalPath(vertex)
+	}
+	return paths
+}
+
 func (dag *Dag) Empty() bool {
 	return len(dag.vertices) == 0
 }
@@ -133,54 +189,97 @@ func (dag *Dag) Copy() *Dag {
 			newDag.upEdges[k][vertex] = weight
 		}
 	}
+	for tag, vertices := range dag.tags {
+		for vertex := range vertices {
+			newDag.AddTag(vertex, tag)
+		}
+	}
 	return newDag
 }
 
+// ApplySelection returns the sub dag matching a space separated list of selectors. A selector is either
+// a vertex or its trailing dotted parts, e.g. orders or shop.orders for model.shop.orders, a source selector
+// like source:name or source:name.table, optionally qualified by the package as in source:package.name.table,
+// or a tag selector like tag:name, optionally prefixed with + to include all ancestors and suffixed with +
+// to include all descendants.
 func (dag *Dag) ApplySelection(selection string) (*Dag, error) {
 	if selection == "" {
 		return dag, nil
 	}
 
-	selections := strings.Split(selection, " ")
-	newDag := CreateDag()
-
-	// TODO check if selections are valid
-
-	for _, model := range selections {
-		newDag.AddVertex(model)
-
-		hasPlusPrefix := strings.HasPrefix(model, "+")
-		hasPlusSuffix := strings.HasSuffix(model, "+")
+	selected := make(map[string]bool)
+	for _, selector := range strings.Fields(selection) {
+		hasPlusPrefix := strings.HasPrefix(selector, "+")
+		hasPlusSuffix := strings.HasSuffix(selector, "+")
+		pattern := strings.TrimSuffix(strings.TrimPrefix(selector, "+"), "+")
 
-		if !hasPlusPrefix && !hasPlusSuffix {
-			continue
+		matches := dag.match(pattern)
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("The selector '%s' does not match any nodes", selector)
 		}
 
-		selectionDag := dag.Copy()
-
-		if hasPlusPrefix {
-			ancestors := selectionDag.Ancestors(model)
-			for vertex := range selectionDag.vertices {
-				if _, seen := ancestors[vertex]; !seen {
-					selectionDag.RemoveVertex(vertex)
+		for _, vertex := range matches {
+			selected[vertex] = true
+			if hasPlusPrefix {
+				for ancestor := range dag.Ancestors(vertex) {
+					selected[ancestor] = true
 				}
 			}
-		}
-
-		if hasPlusSuffix {
-			descendants := selectionDag.Descendants(model)
-			for vertex := range selectionDag.vertices {
-				if _, seen := descendants[vertex]; !seen {
-					selectionDag.RemoveVertex(vertex)
+			if hasPlusSuffix {
+				for descendant := range dag.Descendants(vertex) {
+					selected[descendant] = true
 				}
 			}
 		}
+	}
 
-		newDag.Union(selectionDag)
+	// keep the edges between all selected vertices so that the order is preserved across selectors
+	newDag := dag.Copy()
+	for vertex := range dag.vertices {
+		if _, seen := selected[vertex]; !seen {
+			newDag.RemoveVertex(vertex)
+		}
 	}
 	return newDag, nil
 }
 
+func (dag *Dag) match(pattern string) []string {
+	matches := make([]string, 0)
+	if _, seen := dag.vertices[pattern]; seen {
+		matches = append(matches, pattern)
+	} else if strings.HasPrefix(pattern, SourcePrefix) {
+		name := strings.TrimPrefix(pattern, SourcePrefix)
+		for vertex := range dag.vertices {
+			if !strings.HasPrefix(vertex, SourcePrefix) {
+				continue
+			}
+			// the vertex of a source is source:package.name.table, the package can be left out of the selector
+			qualified := strings.TrimPrefix(vertex, SourcePrefix)
+			unqualified := qualified[strings.Index(qualified, ".")+1:]
+			if matchesSource(qualified, name) || matchesSource(unqualified, name) {
+				matches = append(matches, vertex)
+			}
+		}
+	} else if strings.HasPrefix(pattern, TagPrefix) {
+		for vertex := range dag.tags[strings.TrimPrefix(pattern, TagPrefix)] {
+			if dag.vertices[vertex] {
+				matches = append(matches, vertex)
+			}
+		}
+	} else {
+		for vertex := range dag.vertices {
+			if !strings.HasPrefix(vertex, SourcePrefix) && strings.HasSuffix(vertex, "."+pattern) {
+				matches = append(matches, vertex)
+			}
+		}
+	}
+	return matches
+}
+
+func matchesSource(source string, name string) bool {
+	return source == name || strings.HasPrefix(source, name+".")
+}
+
 func (dag *Dag) Union(otherDag *Dag) {
 	// TODO: maybe rewrite with public api
 	for k, v := range otherDag.vertices {
@@ -202,6 +301,11 @@ func (dag *Dag) Union(otherDag *Dag) {
 			dag.upEdges[k][vertex] = weight
 		}
 	}
+	for tag, vertices := range otherDag.tags {
+		for vertex := range vertices {
+			dag.AddTag(vertex, tag)
+		}
+	}
 }
 
 func (dag *Dag) recursivelyFindEdges(descendantsOrAncestors map[string]bool, seenEdges map[string]bool, edges map[string]int, edgeWalker EdgeWalkFunc) map[string]bool {
@@ -62,12 +62,109 @@ func TestAddEdge(t *testing.T) {
 		t.Error(e)
 	}
 	descendants := dag.Descendants("1")
-	if !reflect.DeepEqual([]string{"2"}, descendants) {
+	if !reflect.DeepEqual(map[string]bool{"2": true}, descendants) {
 		t.Error()
 	}
 
 	ancestors := dag.Ancestors("2")
-	if !reflect.DeepEqual([]string{"1"}, ancestors) {
+	if !reflect.DeepEqual(map[string]bool{"1": true}, ancestors) {
+		t.Error()
+	}
+}
+
+func TestApplySelectionWithAncestorsAndDescendants(t *testing.T) {
+	vertices := []string{"1", "2", "3", "4"}
+	dag := createDag(vertices)
+	dag.AddEdge("1", "2")
+	dag.AddEdge("2", "3")
+	dag.AddEdge("4", "3")
+
+	selection, err := dag.ApplySelection("+2")
+	if err != nil || !verticesEquals(selection.vertices, []string{"1", "2"}) {
+		t.Error(err, selection)
+	}
+
+	selection, err = dag.ApplySelection("2+")
+	if err != nil || !verticesEquals(selection.vertices, []string{"2", "3"}) {
+		t.Error(err, selection)
+	}
+}
+
+func TestApplySelectionKeepsEdgesBetweenSelectors(t *testing.T) {
+	vertices := []string{"1", "2"}
+	dag := createDag(vertices)
+	dag.AddEdge("1", "2")
+
+	selection, _ := dag.ApplySelection("1 2")
+	if !reflect.DeepEqual(selection.VerticesWithoutAncestors(), []string{"1"}) {
+		t.Error()
+	}
+}
+
+func TestApplySelectionWithSources(t *testing.T) {
+	vertices := []string{"source:shop.raw.orders", "source:shop.raw.customers", "source:shop.other.events", "source:stripe.raw.orders", "orders"}
+	dag := createDag(vertices)
+	dag.AddEdge("source:shop.raw.orders", "orders")
+
+	selection, err := dag.ApplySelection("source:raw")
+	if err != nil || !verticesEquals(selection.vertices, []string{"source:shop.raw.orders", "source:shop.raw.customers", "source:stripe.raw.orders"}) {
+		t.Error(err, selection)
+	}
+
+	selection, err = dag.ApplySelection("source:raw.orders+")
+	if err != nil || !verticesEquals(selection.vertices, []string{"source:shop.raw.orders", "source:stripe.raw.orders", "orders"}) {
+		t.Error(err, selection)
+	}
+
+	selection, err = dag.ApplySelection("source:shop.raw.orders+")
+	if err != nil || !verticesEquals(selection.vertices, []string{"source:shop.raw.orders", "orders"}) {
+		t.Error(err, selection)
+	}
+}
+
+func TestApplySelectionWithTags(t *testing.T) {
+	dag := createDag([]string{"source:raw.orders", "orders", "customers", "report"})
+	dag.AddEdge("source:raw.orders", "orders")
+	dag.AddEdge("orders", "report")
+	dag.AddTag("orders", "nightly")
+	dag.AddTag("customers", "nightly")
+	dag.AddTag("source:raw.orders", "pii")
+
+	selection, err := dag.ApplySelection("tag:nightly")
+	if err != nil || !verticesEquals(selection.vertices, []string{"orders", "customers"}) {
+		t.Error(err, selection)
+	}
+
+	selection, err = dag.ApplySelection("tag:pii+")
+	if err != nil || !verticesEquals(selection.vertices, []string{"source:raw.orders", "orders", "report"}) {
+		t.Error(err, selection)
+	}
+
+	if _, err := selection.ApplySelection("tag:nightly"); err != nil {
+		t.Error("expected the tags to be kept in the sub dag", err)
+	}
+	if _, err := dag.ApplySelection("tag:weekly"); err == nil {
+		t.Error("expected an unknown tag to match nothing")
+	}
+}
+
+func TestApplySelectionMatchesTheTrailingPartsOfAVertex(t *testing.T) {
+	dag := createDag([]string{"model.shop.orders", "model.stripe.orders", "model.shop.customers", "source:raw.orders"})
+
+	selection, err := dag.ApplySelection("orders")
+	if err != nil || !verticesEquals(selection.vertices, []string{"model.shop.orders", "model.stripe.orders"}) {
+		t.Error(err, selection)
+	}
+
+	selection, err = dag.ApplySelection("stripe.orders")
+	if err != nil || !verticesEquals(selection.vertices, []string{"model.stripe.orders"}) {
+		t.Error(err, selection)
+	}
+}
+
+func TestApplySelectionFailsWithoutMatches(t *testing.T) {
+	dag := createDag([]string{"1"})
+	if _, err := dag.ApplySelection("2"); err == nil {
 		t.Error()
 	}
 }
@@ -79,3 +176,19 @@ func verticesEquals(current map[string]bool, expected []string) bool {
 	}
 	return reflect.DeepEqual(current, vertices)
 }
+
+func TestCriticalPathsAddTheHeaviestPathToALeaf(t *testing.T) {
+	vertices := []string{"1", "2", "3", "4"}
+	dag := createDag(vertices)
+	dag.AddEdge("1", "2")
+	dag.AddEdge("1", "3")
+	dag.AddEdge("2", "4")
+	weights := map[string]float64{"1": 1, "2": 2, "3": 10, "4": 3}
+
+	paths := dag.CriticalPaths(func(v string) float64 { return weights[v] })
+
+	expected := map[string]float64{"1": 11, "2": 5, "3": 10, "4": 3}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Error(paths)
+	}
+}
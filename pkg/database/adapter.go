@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+)
+
+// Adapter hides the differences between the supported warehouses.
+type Adapter interface {
+	Open() (*sql.DB, error)
+	// FreshnessQuery selects max_loaded_at and snapshotted_at, both in UTC, for a source table.
+	FreshnessQuery(relation string, loadedAtField string, filter string) string
+	// Catalog introspects all relations in the given schemas of a database.
+	Catalog(ctx context.Context, db *sql.DB, database string, schemas []string) ([]CatalogColumn, error)
+	// MaterializationQuery wraps the compiled SQL of a model in the DDL of its materialization.
+	MaterializationQuery(materialization string, relation string, sql string, copyGrants bool) (string, error)
+	// CurrentGrants returns the grantees per privilege on a relation, leaving out ownership.
+	CurrentGrants(ctx context.Context, conn Queryer, relation string) (map[string][]string, error)
+	GrantQuery(relationType string, relation string, privilege string, grantee string) string
+	RevokeQuery(relationType string, relation string, privilege string, grantee string) string
+	// ResultColumns returns the columns a query would return, by running it without returning any rows.
+	ResultColumns(ctx context.Context, conn Queryer, sql string) ([]Column, error)
+	// SameDataType tells whether a data type declared in a contract matches a data type reported by ResultColumns.
+	SameDataType(declared string, actual string) bool
+	// ContractQueries creates the relation of a model with an enforced contract, including the constraints
+	// the warehouse supports for the materialization.
+	ContractQueries(materialization string, relation string, columns []Column, constraints []Constraint, sql string, copyGrants bool) ([]string, error)
+	// SeedQueries loads the rows of a CSV file into a new table, the data types of the columns without one are inferred.
+	SeedQueries(relation string, columns []Column, rows [][]string) []string
+	// SnapshotQueries records the changes to the rows of a query in a type 2 slowly changing dimension, using the
+	// timestamp strategy.
+	SnapshotQueries(relation string, sql string, uniqueKey string, updatedAt string) []string
+	// SessionQueries are run on every new session, to set it up according to the profile.
+	SessionQueries() []string
+	// QueryTagQuery tags the statements of the session, an empty tag restores the query tag of the profile.
+	QueryTagQuery(tag string) string
+	// IsTransient tells whether an error is worth retrying, like a dropped connection, rather than a problem with the SQL.
+	IsTransient(err error) bool
+}
+
+// Queryer is implemented by both *sql.DB and *sql.Conn.
+type Queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Column is a column of a model contract or of the result of a query.
+type Column struct {
+	Name        string
+	DataType    string
+	Constraints []Constraint
+}
+
+// Constraint is a constraint of a model contract, with the referenced relation of a foreign key resolved.
+type Constraint struct {
+	Type       string // not_null, primary_key, unique, check or foreign_key
+	Name       string
+	Expression string
+	Columns    []string // only for model level constraints
+	To         string
+	ToColumns  []string
+}
+
+// CatalogColumn is a single column of a relation as reported by the information schema.
+type CatalogColumn struct {
+	Database      string
+	Schema        string
+	Table         string
+	TableType     string
+	TableComment  string
+	TableOwner    string
+	RowCount      sql.NullInt64
+	Bytes         sql.NullInt64
+	Column        string
+	Index         int
+	DataType      string
+	ColumnComment string
+}
+
+// isNetworkError tells whether an error comes from the network rather than from the warehouse. A deadline
+// or a cancellation also is a net.Error, but retrying it would only run into the same limit again.
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+// NewAdapter returns the adapter matching the type of the connection.
+func NewAdapter(profile *config.Connection) (Adapter, error) {
+	switch profile.Adapter {
+	case "snowflake":
+		return &Snowflake{profile: profile}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported adapter type '%s'", profile.Adapter)
+	}
+}
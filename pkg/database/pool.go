@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+)
+
+// Pool hands out the sessions of a run, one per thread, each a dedicated connection with the session
+// setup of the profile applied. Closing the pool closes every session it handed out.
+type Pool struct {
+	db       *sql.DB
+	adapter  Adapter
+	mu       sync.Mutex
+	sessions []*Session
+}
+
+// Session is a connection that keeps its session state, like the query tag, between statements.
+type Session struct {
+	pool *Pool
+	conn *sql.Conn
+}
+
+// NewPool keeps up to threads idle connections in db, so that the sessions of a run reuse them.
+func NewPool(db *sql.DB, adapter Adapter, threads int) *Pool {
+	db.SetMaxIdleConns(threads + 1)
+	return &Pool{db: db, adapter: adapter}
+}
+
+// Session opens a new session and runs the session setup statements on it.
+func (p *Pool) Session(ctx context.Context) (*Session, error) {
+	session := &Session{pool: p}
+	err := session.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sessions = append(p.sessions, session)
+	return session, nil
+}
+
+// Close closes all sessions, returning their connections to the pool of db.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var firstErr error
+	for _, session := range p.sessions {
+		if err := session.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	p.sessions = nil
+	return firstErr
+}
+
+func (s *Session) connect(ctx context.Context) error {
+	conn, err := s.pool.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("Could not open a session: %w", err)
+	}
+	for _, statement := range s.pool.adapter.SessionQueries() {
+		_, err = conn.ExecContext(ctx, statement)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("Session setup '%s' failed: %w", statement, err)
+		}
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *Session) close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	if err == sql.ErrConnDone {
+		return nil
+	}
+	return err
+}
+
+// Check pings the session and replaces it with a new one when it was dropped, e.g. after a network
+// failure or an expired session.
+func (s *Session) Check(ctx context.Context) error {
+	if s.conn != nil && s.conn.PingContext(ctx) == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	s.discard()
+	return s.connect(ctx)
+}
+
+// discard closes the connection of a dropped session, rather than returning it to the pool of db.
+func (s *Session) discard() {
+	if s.conn != nil {
+		s.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	s.close()
+}
+
+func (s *Session) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if s.conn == nil {
+		return nil, sql.ErrConnDone
+	}
+	return s.conn.ExecContext(ctx, query, args...)
+}
+
+func (s *Session) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if s.conn == nil {
+		return nil, sql.ErrConnDone
+	}
+	return s.conn.QueryContext(ctx, query, args...)
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+)
+
+// fakeDriver records the statements of every connection, a dropped connection fails its ping.
+type fakeDriver struct {
+	mu    sync.Mutex
+	conns []*fakeConn
+}
+
+type fakeConn struct {
+	driver     *fakeDriver
+	statements []string
+	dropped    bool
+	closed     bool
+}
+
+func (d *fakeDriver) Connect(context.Context) (driver.Conn, error) {
+	return d.Open("")
+}
+
+func (d *fakeDriver) Driver() driver.Driver {
+	return d
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	conn := &fakeConn{driver: d}
+	d.conns = append(d.conns, conn)
+	return conn, nil
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.statements = append(c.statements, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeConn) Ping(context.Context) error {
+	if c.dropped {
+		return errors.New("session expired")
+	}
+	return nil
+}
+
+func TestSessionsAreSetUpAndReconnectWhenDropped(t *testing.T) {
+	fake := &fakeDriver{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	adapter := &Snowflake{profile: &config.Connection{Warehouse: "transforming", QueryTag: "dbt's run", Timezone: "UTC"}}
+	pool := NewPool(db, adapter, 2)
+
+	session, err := pool.Session(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup := []string{"use warehouse transforming", "alter session set query_tag = 'dbt''s run'", "alter session set timezone = 'UTC'"}
+	if !reflect.DeepEqual(fake.conns[0].statements, setup) {
+		t.Error(fake.conns[0].statements)
+	}
+
+	fake.conns[0].dropped = true
+	if err := session.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.conns) != 2 || !fake.conns[0].closed || !reflect.DeepEqual(fake.conns[1].statements, setup) {
+		t.Errorf("expected the dropped connection to be replaced by a new session, got %d connections", len(fake.conns))
+	}
+	if _, err := session.ExecContext(context.Background(), "select 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.ExecContext(context.Background(), "select 1"); err != sql.ErrConnDone {
+		t.Error(err)
+	}
+}
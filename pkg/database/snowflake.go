@@ -1,55 +1,554 @@
 package database
 
 import (
+	"context"
 	"crypto/rsa"
+	"crypto/x509"
 	"database/sql"
+	"encoding/base64"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/mdesmet/go-dbt/pkg/config"
 	"github.com/snowflakedb/gosnowflake"
 	"github.com/youmark/pkcs8"
 )
 
+type Snowflake struct {
+	profile *config.Connection
+}
+
 func Connect(profile *config.Connection) *sql.DB {
-	dsn, err := dsn(profile)
+	db, err := Open(profile)
 	if err != nil {
 		log.Fatal(err)
 	}
-	db, err := sql.Open("snowflake", dsn)
-	log.Println(dsn)
+	return db
+}
+
+// Open returns a handle to the database described by profile, returning an error instead of bailing out.
+func Open(profile *config.Connection) (*sql.DB, error) {
+	adapter, err := NewAdapter(profile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	return db
+	return adapter.Open()
+}
+
+func (s *Snowflake) Open() (*sql.DB, error) {
+	cfg, err := snowflakeConfig(s.profile)
+	if err != nil {
+		return nil, err
+	}
+	// connects with the config instead of a DSN, which would lowercase an Okta URL
+	return sql.OpenDB(gosnowflake.NewConnector(gosnowflake.SnowflakeDriver{}, *cfg)), nil
 }
 
-func dsn(profile *config.Connection) (string, error) {
-	var privateKey *rsa.PrivateKey
+// ReadPrivateKey decodes the private key of the profile, either the inline private_key or the file at
+// private_key_path. Both PEM and base64 encoded DER are accepted, as well as unencrypted keys.
+func ReadPrivateKey(profile *config.Connection) (*rsa.PrivateKey, error) {
+	source := "private_key"
+	content := []byte(profile.PrivateKey)
 	if profile.PrivateKeyPath != "" {
-		privateFileContent, err := ioutil.ReadFile(profile.PrivateKeyPath)
+		source = profile.PrivateKeyPath
+		var err error
+		content, err = ioutil.ReadFile(profile.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read private key: %w", err)
+		}
+	}
+	privateKey, err := parsePrivateKey(content, []byte(profile.PrivateKeyPassphrase))
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode private key %s: %w", source, err)
+	}
+	return privateKey, nil
+}
+
+func parsePrivateKey(content []byte, passphrase []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		// the base64 encoded DER without the PEM header and footer
+		der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(content)), ""))
+		if err != nil || len(der) == 0 {
+			return nil, errors.New("expected a PEM encoded key or base64 encoded DER")
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		if len(passphrase) > 0 {
+			block.Type = "ENCRYPTED PRIVATE KEY"
+		}
+	}
+
+	switch block.Type {
+	case "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, errors.New("the key is encrypted, set private_key_passphrase")
+		}
+		privateKey, err := pkcs8.ParsePKCS8PrivateKeyRSA(block.Bytes, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("could not decrypt the key, is private_key_passphrase correct? %v", err)
+		}
+		return privateKey, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("not a PKCS #8 private key: %v", err)
+		}
+		privateKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("Snowflake requires an RSA key, got %T", key)
+		}
+		return privateKey, nil
+	case "RSA PRIVATE KEY":
+		if _, encrypted := block.Headers["Proc-Type"]; encrypted {
+			return nil, errors.New("legacy encrypted PEM keys are not supported, convert the key to PKCS #8 with openssl pkcs8 -topk8")
+		}
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unexpected PEM block '%s', expected a private key", block.Type)
+	}
+}
+
+func (s *Snowflake) FreshnessQuery(relation string, loadedAtField string, filter string) string {
+	query := fmt.Sprintf(`select
+    convert_timezone('UTC', max(%s))::timestamp_ntz as max_loaded_at,
+    convert_timezone('UTC', current_timestamp())::timestamp_ntz as snapshotted_at
+from %s`, loadedAtField, relation)
+	if filter != "" {
+		query += fmt.Sprintf("\nwhere %s", filter)
+	}
+	return query
+}
+
+func (s *Snowflake) Catalog(ctx context.Context, db *sql.DB, database string, schemas []string) ([]CatalogColumn, error) {
+	if len(schemas) == 0 {
+		return nil, nil
+	}
+	placeholders := make([]string, len(schemas))
+	args := make([]interface{}, len(schemas))
+	for i, schema := range schemas {
+		placeholders[i] = "upper(?)"
+		args[i] = schema
+	}
+	query := fmt.Sprintf(`select
+    t.table_catalog,
+    t.table_schema,
+    t.table_name,
+    t.table_type,
+    coalesce(t.comment, ''),
+    coalesce(t.table_owner, ''),
+    t.row_count,
+    t.bytes,
+    c.column_name,
+    c.ordinal_position,
+    c.data_type,
+    coalesce(c.comment, '')
+from %[1]s.information_schema.tables t
+join %[1]s.information_schema.columns c
+    on t.table_catalog = c.table_catalog
+    and t.table_schema = c.table_schema
+    and t.table_name = c.table_name
+where t.table_schema in (%[2]s)
+order by t.table_schema, t.table_name, c.ordinal_position`, database, strings.Join(placeholders, ", "))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]CatalogColumn, 0)
+	for rows.Next() {
+		column := CatalogColumn{}
+		err := rows.Scan(&column.Database, &column.Schema, &column.Table, &column.TableType, &column.TableComment, &column.TableOwner,
+			&column.RowCount, &column.Bytes, &column.Column, &column.Index, &column.DataType, &column.ColumnComment)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-		der, _ := pem.Decode(privateFileContent)
-		privateKey, err = pkcs8.ParsePKCS8PrivateKeyRSA(der.Bytes, []byte(profile.PrivateKeyPassphrase))
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+func (s *Snowflake) MaterializationQuery(materialization string, relation string, sql string, copyGrants bool) (string, error) {
+	copy := ""
+	if copyGrants {
+		copy = " copy grants"
+	}
+	switch materialization {
+	case "view":
+		return fmt.Sprintf("create or replace view %s%s as (\n%s\n)", relation, copy, sql), nil
+	case "table":
+		return fmt.Sprintf("create or replace table %s%s as (\n%s\n)", relation, copy, sql), nil
+	default:
+		return "", fmt.Errorf("Unsupported materialization '%s', expected view or table", materialization)
+	}
+}
+
+func (s *Snowflake) CurrentGrants(ctx context.Context, conn Queryer, relation string) (map[string][]string, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("show grants on %s", relation))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	grants := make(map[string][]string)
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		err := rows.Scan(pointers...)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
+		}
+		row := make(map[string]string)
+		for i, column := range columns {
+			row[strings.ToLower(column)] = values[i].String
+		}
+		if row["granted_to"] != "ROLE" || row["privilege"] == "OWNERSHIP" {
+			continue
+		}
+		privilege := strings.ToLower(row["privilege"])
+		grants[privilege] = append(grants[privilege], strings.ToLower(row["grantee_name"]))
+	}
+	return grants, rows.Err()
+}
+
+func (s *Snowflake) GrantQuery(relationType string, relation string, privilege string, grantee string) string {
+	return fmt.Sprintf("grant %s on %s %s to role %s", privilege, relationType, relation, grantee)
+}
+
+func (s *Snowflake) RevokeQuery(relationType string, relation string, privilege string, grantee string) string {
+	return fmt.Sprintf("revoke %s on %s %s from role %s", privilege, relationType, relation, grantee)
+}
+
+func (s *Snowflake) ResultColumns(ctx context.Context, conn Queryer, sql string) ([]Column, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("select * from (\n%s\n) as model_subq where false limit 0", sql))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]Column, 0, len(columnTypes))
+	for _, columnType := range columnTypes {
+		columns = append(columns, Column{Name: columnType.Name(), DataType: columnType.DatabaseTypeName()})
+	}
+	return columns, rows.Err()
+}
+
+// snowflakeTypes maps the data types that can be declared to the internal types reported by the driver.
+var snowflakeTypes = map[string]string{
+	"NUMBER": "FIXED", "NUMERIC": "FIXED", "DECIMAL": "FIXED", "INT": "FIXED", "INTEGER": "FIXED",
+	"BIGINT": "FIXED", "SMALLINT": "FIXED", "TINYINT": "FIXED", "BYTEINT": "FIXED",
+	"FLOAT": "REAL", "FLOAT4": "REAL", "FLOAT8": "REAL", "DOUBLE": "REAL", "DOUBLE PRECISION": "REAL",
+	"VARCHAR": "TEXT", "CHAR": "TEXT", "CHARACTER": "TEXT", "STRING": "TEXT", "NVARCHAR": "TEXT", "NCHAR": "TEXT",
+	"VARBINARY": "BINARY",
+	"DATETIME":  "TIMESTAMP_NTZ", "TIMESTAMP": "TIMESTAMP_NTZ",
+}
+
+// SameDataType compares the base types only, the driver doesn't report lengths, precisions and scales.
+func (s *Snowflake) SameDataType(declared string, actual string) bool {
+	base := strings.ToUpper(strings.TrimSpace(declared))
+	if i := strings.Index(base, "("); i >= 0 {
+		base = strings.TrimSpace(base[:i])
+	}
+	if internal, ok := snowflakeTypes[base]; ok {
+		base = internal
+	}
+	return base == strings.ToUpper(actual)
+}
+
+// ContractQueries creates tables with their column definitions and inserts the rows afterwards. Snowflake
+// only enforces not null constraints, check constraints and constraints on views are not supported.
+func (s *Snowflake) ContractQueries(materialization string, relation string, columns []Column, constraints []Constraint, sql string, copyGrants bool) ([]string, error) {
+	if materialization != "table" {
+		for _, column := range columns {
+			if len(column.Constraints) > 0 {
+				fmt.Fprintf(config.Stdout, "Warning: constraints on column '%s' of %s are not supported on a %s\n", column.Name, relation, materialization)
+			}
+		}
+		if len(constraints) > 0 {
+			fmt.Fprintf(config.Stdout, "Warning: the constraints of %s are not supported on a %s\n", relation, materialization)
+		}
+		query, err := s.MaterializationQuery(materialization, relation, sql, copyGrants)
+		return []string{query}, err
+	}
+
+	definitions := make([]string, 0, len(columns)+len(constraints))
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		definition := column.Name + " " + column.DataType
+		for _, constraint := range column.Constraints {
+			if constraint.Type == "check" {
+				fmt.Fprintf(config.Stdout, "Warning: check constraint on column '%s' of %s is not supported on Snowflake\n", column.Name, relation)
+				continue
+			}
+			definition += " " + snowflakeConstraint(constraint, "")
+		}
+		definitions = append(definitions, definition)
+		names = append(names, column.Name)
+	}
+	for _, constraint := range constraints {
+		if constraint.Type == "check" || constraint.Type == "not_null" {
+			fmt.Fprintf(config.Stdout, "Warning: %s constraint of %s is not supported on Snowflake at the model level\n", constraint.Type, relation)
+			continue
+		}
+		definitions = append(definitions, snowflakeConstraint(constraint, fmt.Sprintf(" (%s)", strings.Join(constraint.Columns, ", "))))
+	}
+
+	copy := ""
+	if copyGrants {
+		copy = " copy grants"
+	}
+	return []string{
+		fmt.Sprintf("create or replace table %s (\n    %s\n)%s", relation, strings.Join(definitions, ",\n    "), copy),
+		fmt.Sprintf("insert into %s (%s)\nselect %s from (\n%s\n) as model_subq", relation, strings.Join(names, ", "), strings.Join(names, ", "), sql),
+	}, nil
+}
+
+// snowflakeConstraint renders a constraint, columns is empty for a constraint on a single column.
+func snowflakeConstraint(constraint Constraint, columns string) string {
+	sql := ""
+	if constraint.Name != "" {
+		sql = fmt.Sprintf("constraint %s ", constraint.Name)
+	}
+	switch constraint.Type {
+	case "not_null":
+		sql += "not null"
+	case "primary_key":
+		sql += "primary key" + columns
+	case "unique":
+		sql += "unique" + columns
+	case "foreign_key":
+		if columns != "" {
+			sql += "foreign key" + columns + " "
+		}
+		sql += "references " + constraint.To
+		if len(constraint.ToColumns) > 0 {
+			sql += fmt.Sprintf(" (%s)", strings.Join(constraint.ToColumns, ", "))
+		}
+	}
+	return sql
+}
+
+// seedBatchSize is the number of rows per insert, Snowflake accepts at most 16384 rows in a values clause.
+const seedBatchSize = 1000
+
+var (
+	seedInteger   = regexp.MustCompile(`^-?\d+$`)
+	seedFloat     = regexp.MustCompile(`^-?(\d+\.\d*|\.\d+|\d+)([eE][-+]?\d+)?$`)
+	seedBoolean   = regexp.MustCompile(`(?i)^(true|false)$`)
+	seedDate      = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	seedTimestamp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}(\.\d+)?$`)
+)
+
+// SeedQueries infers the narrowest type that fits all the values of a column, empty values are loaded as null.
+func (s *Snowflake) SeedQueries(relation string, columns []Column, rows [][]string) []string {
+	definitions := make([]string, 0, len(columns))
+	names := make([]string, 0, len(columns))
+	for i, column := range columns {
+		dataType := column.DataType
+		if dataType == "" {
+			values := make([]string, 0, len(rows))
+			for _, row := range rows {
+				values = append(values, row[i])
+			}
+			dataType = seedDataType(values)
+		}
+		definitions = append(definitions, column.Name+" "+dataType)
+		names = append(names, column.Name)
+	}
+
+	queries := []string{fmt.Sprintf("create or replace table %s (\n    %s\n)", relation, strings.Join(definitions, ",\n    "))}
+	for start := 0; start < len(rows); start += seedBatchSize {
+		end := start + seedBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		values := make([]string, 0, end-start)
+		for _, row := range rows[start:end] {
+			literals := make([]string, 0, len(row))
+			for _, value := range row {
+				if value == "" {
+					literals = append(literals, "null")
+				} else {
+					literals = append(literals, snowflakeLiteral(value))
+				}
+			}
+			values = append(values, "("+strings.Join(literals, ", ")+")")
+		}
+		queries = append(queries, fmt.Sprintf("insert into %s (%s) values\n%s", relation, strings.Join(names, ", "), strings.Join(values, ",\n")))
+	}
+	return queries
+}
+
+func seedDataType(values []string) string {
+	for _, candidate := range []struct {
+		pattern  *regexp.Regexp
+		dataType string
+	}{
+		{seedInteger, "number"},
+		{seedFloat, "float"},
+		{seedBoolean, "boolean"},
+		{seedDate, "date"},
+		{seedTimestamp, "timestamp_ntz"},
+	} {
+		matches, empty := true, true
+		for _, value := range values {
+			if value == "" {
+				continue
+			}
+			empty = false
+			if !candidate.pattern.MatchString(value) {
+				matches = false
+				break
+			}
+		}
+		if matches && !empty {
+			return candidate.dataType
 		}
 	}
+	return "varchar"
+}
+
+// SnapshotQueries creates the snapshot with the current rows on the first run. Afterwards the current version
+// of every row with a newer updated_at is closed and the new and changed rows are inserted.
+func (s *Snowflake) SnapshotQueries(relation string, sql string, uniqueKey string, updatedAt string) []string {
+	scdId := fmt.Sprintf("md5(coalesce(cast(%s as varchar), '') || '|' || coalesce(cast(%s as varchar), ''))", uniqueKey, updatedAt)
+	columns := fmt.Sprintf("source.*,\n    %s as dbt_scd_id,\n    %s as dbt_updated_at,\n    %s as dbt_valid_from,\n    cast(null as timestamp_ntz) as dbt_valid_to",
+		scdId, updatedAt, updatedAt)
+	return []string{
+		fmt.Sprintf("create table if not exists %s as\nselect %s\nfrom (\n%s\n) as source", relation, columns, sql),
+		fmt.Sprintf("merge into %s as snapshot\nusing (\n%s\n) as source\non snapshot.%s = source.%s and snapshot.dbt_valid_to is null\nwhen matched and source.%s > snapshot.dbt_updated_at then update set dbt_valid_to = source.%s",
+			relation, sql, uniqueKey, uniqueKey, updatedAt, updatedAt),
+		fmt.Sprintf("insert into %s\nselect %s\nfrom (\n%s\n) as source\nwhere not exists (\n    select 1 from %s as snapshot where snapshot.%s = source.%s and snapshot.dbt_valid_to is null\n)",
+			relation, columns, sql, relation, uniqueKey, uniqueKey),
+	}
+}
+
+// SessionQueries selects the warehouse, failing early when it doesn't exist, and sets the query tag,
+// timezone and other session parameters of the profile.
+func (s *Snowflake) SessionQueries() []string {
+	queries := make([]string, 0)
+	if s.profile.Warehouse != "" {
+		queries = append(queries, fmt.Sprintf("use warehouse %s", s.profile.Warehouse))
+	}
+	parameters := make(map[string]string, len(s.profile.SessionParameters)+2)
+	for name, value := range s.profile.SessionParameters {
+		parameters[strings.ToLower(name)] = value
+	}
+	if s.profile.QueryTag != "" {
+		parameters["query_tag"] = s.profile.QueryTag
+	}
+	if s.profile.Timezone != "" {
+		parameters["timezone"] = s.profile.Timezone
+	}
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		queries = append(queries, fmt.Sprintf("alter session set %s = %s", name, snowflakeLiteral(parameters[name])))
+	}
+	return queries
+}
 
+func (s *Snowflake) QueryTagQuery(tag string) string {
+	if tag == "" {
+		tag = s.profile.QueryTag
+	}
+	if tag == "" {
+		return "alter session unset query_tag"
+	}
+	return fmt.Sprintf("alter session set query_tag = %s", snowflakeLiteral(tag))
+}
+
+// snowflakeLiteral quotes a string literal.
+func snowflakeLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// transientSnowflakeErrors are the codes of network failures and an unavailable service.
+var transientSnowflakeErrors = map[int]bool{
+	gosnowflake.ErrCodeServiceUnavailable: true,
+	gosnowflake.ErrFailedToPostQuery:      true,
+	gosnowflake.ErrFailedToRenewSession:   true,
+	gosnowflake.ErrFailedToHeartbeat:      true,
+	gosnowflake.ErrFailedToGetChunk:       true,
+	390114:                                true, // the authentication token has expired
+}
+
+// IsTransient retries network errors, the codes above and the SQL states of connection exceptions
+// (class 08) and serialization failures (40001).
+func (s *Snowflake) IsTransient(err error) bool {
+	var snowflakeErr *gosnowflake.SnowflakeError
+	if errors.As(err, &snowflakeErr) {
+		return transientSnowflakeErrors[snowflakeErr.Number] || strings.HasPrefix(snowflakeErr.SQLState, "08") || snowflakeErr.SQLState == "40001"
+	}
+	return isNetworkError(err)
+}
+
+// snowflakeConfig returns the driver config of a profile, which contains its credentials.
+func snowflakeConfig(profile *config.Connection) (*gosnowflake.Config, error) {
 	cfg := &gosnowflake.Config{
-		Account:       profile.Account,
-		Authenticator: gosnowflake.AuthTypeJwt,
-		User:          profile.User,
-		Role:          profile.Role,
-		Database:      profile.Database,
-		Warehouse:     profile.Warehouse,
-		Schema:        profile.Schema,
-		PrivateKey:    privateKey,
-	}
-
-	dsn, err := gosnowflake.DSN(cfg)
-	return dsn, err
+		Account:   profile.Account,
+		User:      profile.User,
+		Role:      profile.Role,
+		Database:  profile.Database,
+		Warehouse: profile.Warehouse,
+		Schema:    profile.Schema,
+	}
+
+	authenticator := profile.AuthenticatorName()
+	switch {
+	case authenticator == "snowflake":
+		cfg.Authenticator = gosnowflake.AuthTypeSnowflake
+		cfg.Password = profile.Password
+	case authenticator == "jwt":
+		privateKey, err := ReadPrivateKey(profile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Authenticator = gosnowflake.AuthTypeJwt
+		cfg.PrivateKey = privateKey
+	case authenticator == "oauth":
+		cfg.Authenticator = gosnowflake.AuthTypeOAuth
+		cfg.Token = profile.Token
+	case authenticator == "externalbrowser":
+		cfg.Authenticator = gosnowflake.AuthTypeExternalBrowser
+	case strings.HasPrefix(strings.ToLower(authenticator), "https://"):
+		oktaURL, err := url.Parse(profile.Authenticator)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Okta URL '%s': %v", profile.Authenticator, err)
+		}
+		cfg.Authenticator = gosnowflake.AuthTypeOkta
+		cfg.OktaURL = oktaURL
+		cfg.Password = profile.Password
+	default:
+		return nil, fmt.Errorf("Unsupported authenticator '%s', expected snowflake, oauth, externalbrowser, jwt or an Okta URL", profile.Authenticator)
+	}
+	if profile.ClientSessionKeepAlive {
+		// sends heartbeats, so that idle sessions of a long run don't expire
+		keepAlive := "true"
+		cfg.Params = map[string]*string{"client_session_keep_alive": &keepAlive}
+	}
+
+	return cfg, nil
 }
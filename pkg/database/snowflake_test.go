@@ -0,0 +1,78 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/youmark/pkcs8"
+)
+
+func TestReadPrivateKeyAcceptsTheCommonEncodings(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	encrypted, err := pkcs8.MarshalPrivateKey(key, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, profile := range map[string]config.Connection{
+		"unencrypted PEM": {PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))},
+		"PKCS #1 PEM":     {PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))},
+		"base64 DER":      {PrivateKey: base64.StdEncoding.EncodeToString(der)},
+		"encrypted PEM":   {PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted})), PrivateKeyPassphrase: "secret"},
+	} {
+		privateKey, err := ReadPrivateKey(&profile)
+		if err != nil || !privateKey.Equal(key) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	for expected, profile := range map[string]config.Connection{
+		"set private_key_passphrase":         {PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted}))},
+		"is private_key_passphrase correct?": {PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted})), PrivateKeyPassphrase: "wrong"},
+		"expected a PEM encoded key":         {PrivateKey: "not a key!"},
+		"Could not read private key":         {PrivateKeyPath: "/does/not/exist.p8"},
+		"unexpected PEM block 'CERTIFICATE'": {PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))},
+	} {
+		_, err := ReadPrivateKey(&profile)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected '%s', got %v", expected, err)
+		}
+	}
+}
+
+func TestSnowflakeConfigSelectsTheAuthenticator(t *testing.T) {
+	for authenticator, profile := range map[gosnowflake.AuthType]config.Connection{
+		gosnowflake.AuthTypeSnowflake:       {Account: "acc", User: "bob", Password: "pw"},
+		gosnowflake.AuthTypeOAuth:           {Account: "acc", User: "bob", Authenticator: "OAuth", Token: "token"},
+		gosnowflake.AuthTypeExternalBrowser: {Account: "acc", User: "bob", Authenticator: "externalbrowser"},
+	} {
+		cfg, err := snowflakeConfig(&profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Authenticator != authenticator {
+			t.Error(profile.Authenticator, cfg.Authenticator)
+		}
+	}
+
+	// the path of an Okta URL is case sensitive
+	cfg, err := snowflakeConfig(&config.Connection{Account: "acc", User: "bob", Password: "pw", Authenticator: "https://acme.okta.com/App/Snowflake"})
+	if err != nil || cfg.Authenticator != gosnowflake.AuthTypeOkta || cfg.OktaURL.String() != "https://acme.okta.com/App/Snowflake" {
+		t.Error(cfg, err)
+	}
+
+	if _, err := snowflakeConfig(&config.Connection{Account: "acc", User: "bob", PrivateKey: "garbage"}); err == nil {
+		t.Error("expected an invalid key to fail instead of crashing")
+	}
+}
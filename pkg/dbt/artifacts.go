@@ -0,0 +1,58 @@
+package dbt
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+)
+
+type artifactMetadata struct {
+	DbtSchemaVersion string    `json:"dbt_schema_version"`
+	DbtVersion       string    `json:"dbt_version"`
+	GeneratedAt      time.Time `json:"generated_at"`
+	InvocationId     string    `json:"invocation_id"`
+}
+
+func (g *Graph) artifactMetadata(schemaVersion string) artifactMetadata {
+	return artifactMetadata{
+		DbtSchemaVersion: schemaVersion,
+		DbtVersion:       version,
+		GeneratedAt:      time.Now().UTC(),
+		InvocationId:     g.InvocationId,
+	}
+}
+
+// targetPath returns the directory where all artifacts are written to.
+func (g *Graph) targetPath() string {
+	targetPath := g.ProjectConfig.TargetPath
+	if targetPath == "" {
+		targetPath = "target"
+	}
+	if filepath.IsAbs(targetPath) {
+		return targetPath
+	}
+	return filepath.Join(g.ProjectDir, targetPath)
+}
+
+// writeArtifact writes artifact as JSON to the target path, with all secrets scrubbed.
+func (g *Graph) writeArtifact(name string, artifact interface{}) string {
+	content, err := json.MarshalIndent(artifact, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.MkdirAll(g.targetPath(), 0755)
+	if err != nil {
+		log.Fatal(err)
+	}
+	path := filepath.Join(g.targetPath(), name)
+	err = ioutil.WriteFile(path, []byte(config.Scrub(string(content))), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,166 @@
+package dbt
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/dag"
+	"github.com/mdesmet/go-dbt/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+// buildTask runs the selected seeds, models and snapshots and tests them in a single DAG, so that the
+// tests of a node run right after it and a failing test skips everything downstream.
+func buildTask(cmd *cobra.Command, _ []string) {
+	graph := createGraph(cmd)
+	dag := buildDag(graph)
+
+	selection, _ := cmd.Flags().GetString("select")
+	dag, err := dag.ApplySelection(selection)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keepResourceTypes(dag, graph, "seed", "model", "snapshot", "test")
+
+	failFast, _ := cmd.Flags().GetBool("fail-fast")
+	maxRunDuration, _ := cmd.Flags().GetDuration("max-run-duration")
+	runDag(graph, dag, failFast, maxRunDuration, invocationArgs(cmd, "build"))
+}
+
+// buildDag is the dag of all nodes, where the children of a node also depend on its tests.
+func buildDag(graph *Graph) *dag.Dag {
+	buildDag := dag.CreateDag()
+	populateDag(graph, buildDag)
+	for id, test := range graph.Models {
+		if test.ResourceType != "test" || test.TestedNode == "" {
+			continue
+		}
+		children := make(map[string]bool)
+		if tested, ok := graph.Models[test.TestedNode]; ok {
+			children = tested.Children
+		} else if source := graph.sourceBySelector(test.TestedNode); source != nil {
+			children = source.Children
+		}
+		ancestors := buildDag.Ancestors(id)
+		for child := range children {
+			// a relationships test may depend on a child of the node it tests
+			if graph.Models[child].ResourceType == "test" || ancestors[child] {
+				continue
+			}
+			buildDag.AddEdge(id, child)
+		}
+	}
+	if !buildDag.Valid() {
+		log.Fatal("Dag contains cycles, can't continue")
+	}
+	return buildDag
+}
+
+// keepResourceTypes drops the vertices of other resource types from a selection, sources only take
+// part in the selection but have nothing to run.
+func keepResourceTypes(selection *dag.Dag, graph *Graph, resourceTypes ...string) {
+	keep := make(map[string]bool, len(resourceTypes))
+	for _, resourceType := range resourceTypes {
+		keep[resourceType] = true
+	}
+	for _, vertex := range selection.Vertices() {
+		if model, ok := graph.Models[vertex]; !ok || !keep[model.ResourceType] {
+			selection.RemoveVertex(vertex)
+		}
+	}
+}
+
+// nodeQueries returns the statements creating the relation of a model, seed or snapshot.
+func (g *Graph) nodeQueries(adapter database.Adapter, model *Model) ([]string, error) {
+	switch model.ResourceType {
+	case "seed":
+		columns, rows, err := readSeed(model)
+		if err != nil {
+			return nil, err
+		}
+		return adapter.SeedQueries(model.fqn().String(), columns, rows), nil
+	case "snapshot":
+		if model.Config.Strategy != "timestamp" {
+			return nil, fmt.Errorf("Snapshot %s: unsupported strategy '%s', only timestamp is supported", model.Name, model.Config.Strategy)
+		}
+		if model.Config.UniqueKey == "" || model.Config.UpdatedAt == "" {
+			return nil, fmt.Errorf("Snapshot %s: the timestamp strategy needs a unique_key and updated_at", model.Name)
+		}
+		return adapter.SnapshotQueries(model.fqn().String(), model.CompiledSql, model.Config.UniqueKey, model.Config.UpdatedAt), nil
+	default:
+		return g.materializationQueries(adapter, model)
+	}
+}
+
+// readSeed reads the header and the rows of the CSV file of a seed, column_types sets the data types of columns.
+func readSeed(model *Model) ([]database.Column, [][]string, error) {
+	file, err := os.Open(model.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not read seed %s: %w", model.Name, err)
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("Seed %s has no header", model.Name)
+	}
+	columns := make([]database.Column, 0, len(records[0]))
+	for _, name := range records[0] {
+		name = strings.TrimSpace(name)
+		columns = append(columns, database.Column{Name: name, DataType: model.Config.ColumnTypes[strings.ToLower(name)]})
+	}
+	return columns, records[1:], nil
+}
+
+// testFailure is the outcome of a test that returned rows, which is only a warning for a severity of warn.
+type testFailure struct {
+	status  TaskStatus
+	message string
+}
+
+func (f *testFailure) Error() string {
+	return f.message
+}
+
+// executeTest counts the rows the query of a test returns, a test passes when there are none.
+func (g *Graph) executeTest(ctx context.Context, conn database.Queryer, model *Model) error {
+	query := fmt.Sprintf("select count(*) as failures from (\n%s\n) as dbt_internal_test", model.CompiledSql)
+	fmt.Fprintln(config.Stdout, "Going to execute SQL", query)
+	var failures int64
+	err := queryWithTimeout(ctx, conn, func(ctx context.Context) error {
+		rows, err := conn.QueryContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		if rows.Next() {
+			err = rows.Scan(&failures)
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("An error occurred while running test %s: %w", model.Name, err)
+	}
+
+	if failures == 0 {
+		return nil
+	}
+	message := fmt.Sprintf("Test %s failed, got %d results, configured to fail if != 0", model.Name, failures)
+	if model.Config.Severity != "warn" {
+		return &testFailure{status: Failed, message: message}
+	}
+	if err := g.warn(testWarning, message); err != nil {
+		return &testFailure{status: Failed, message: err.Error()}
+	}
+	return &testFailure{status: Warned, message: message}
+}
@@ -0,0 +1,102 @@
+package dbt
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/database"
+)
+
+func TestBuildDagRunsTestsBeforeTheChildrenOfTheTestedNode(t *testing.T) {
+	g := &Graph{Models: make(map[string]*Model), Sources: make(map[string]*Source)}
+	g.addNode(g.newNode("seed", "countries", "demo", "project", "project/seeds/countries.csv", ""))
+	g.addNode(g.newNode("model", "customers", "demo", "project", "project/models/customers.sql", "select * from {{ ref('countries') }}"))
+	g.addNode(g.newNode("model", "orders", "demo", "project", "project/models/orders.sql", "select * from {{ ref('customers') }}"))
+	g.Models["seed.demo.countries"].Columns = []config.ColumnProperties{{Name: "code", Tests: []interface{}{"unique"}}}
+	g.Models["model.demo.orders"].Columns = []config.ColumnProperties{{Name: "customer_id", Tests: []interface{}{
+		map[string]interface{}{"relationships": map[string]interface{}{"to": "ref('customers')", "field": "id", "severity": "warn"}},
+	}}}
+	g.addGenericTests()
+	g.parseModels()
+
+	unique, relationships := g.Models["test.demo.unique_countries_code"], g.Models["test.demo.relationships_orders_customer_id"]
+	if unique == nil || relationships == nil {
+		t.Fatal(g.Models)
+	}
+	if relationships.Config.Severity != "warn" || relationships.TestedNode != "model.demo.orders" {
+		t.Error(relationships.Config.Severity, relationships.TestedNode)
+	}
+
+	dag := buildDag(g)
+	if !dag.Descendants("test.demo.unique_countries_code")["model.demo.customers"] {
+		t.Error("a failing test of countries should skip customers")
+	}
+	// the relationships test depends on customers, which is a parent of orders
+	if !dag.Descendants("model.demo.customers")["test.demo.relationships_orders_customer_id"] || dag.Descendants("test.demo.relationships_orders_customer_id")["model.demo.customers"] {
+		t.Error(dag.Descendants("test.demo.relationships_orders_customer_id"))
+	}
+}
+
+func TestGenericTestsNeedAColumn(t *testing.T) {
+	if _, err := genericTestSql(genericTest{name: "not_null"}, "ref('orders')", ""); err == nil {
+		t.Error()
+	}
+	sql, err := genericTestSql(genericTest{name: "accepted_values", arguments: map[string]interface{}{"values": []interface{}{"open", "it's"}}}, "ref('orders')", "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql != "select * from {{ ref('orders') }} where status not in ('open', 'it''s')" {
+		t.Error(sql)
+	}
+}
+
+func TestTestExceedingItsTimeoutIsNotRetried(t *testing.T) {
+	slow := &tableDriver{blocking: true}
+	db := sql.OpenDB(slow)
+	defer db.Close()
+
+	connection := config.Connection{Adapter: "snowflake", Retries: 2, QueryTimeout: 1}
+	g := Graph{
+		Models:      make(map[string]*Model),
+		Profiles:    config.Profiles{"demo": {Target: "dev", Outputs: map[string]config.Connection{"dev": connection}}},
+		ProfileName: "demo",
+	}
+	test := g.newNode("test", "not_null_orders_id", "demo", "project", "project/models/schema.yml", "select * from orders where id is null")
+	adapter, _ := database.NewAdapter(&connection)
+	session, err := database.NewPool(db, adapter, 1).Session(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := runModel(context.Background(), session, adapter, g, 1, test)
+	if result.ok != TimedOut || len(result.attempts) != 1 || len(slow.statements) != 1 {
+		t.Error(result.ok, result.desc, len(result.attempts), slow.statements)
+	}
+}
+
+func TestRunQueryExceedingItsTimeoutTimesTheModelOut(t *testing.T) {
+	slow := &tableDriver{blocking: true}
+	db := sql.OpenDB(slow)
+	defer db.Close()
+
+	connection := config.Connection{Adapter: "snowflake", Retries: 2, QueryTimeout: 1}
+	g := Graph{
+		Models:      make(map[string]*Model),
+		Macros:      make(map[string]*Macro),
+		Profiles:    config.Profiles{"demo": {Target: "dev", Outputs: map[string]config.Connection{"dev": connection}}},
+		ProfileName: "demo",
+	}
+	model := g.newNode("model", "pivoted", "demo", "project", "project/models/pivoted.sql", `{% set methods = run_query("select distinct payment_method from payments") %}select 1`)
+	adapter, _ := database.NewAdapter(&connection)
+	session, err := database.NewPool(db, adapter, 1).Session(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := runModel(context.Background(), session, adapter, g, 1, model)
+	if result.ok != TimedOut || len(result.attempts) != 1 || len(slow.statements) != 1 {
+		t.Error(result.ok, result.desc, len(result.attempts), slow.statements)
+	}
+}
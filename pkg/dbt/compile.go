@@ -1,18 +1,49 @@
 package dbt
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"os"
 
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/database"
 	"github.com/spf13/cobra"
 )
 
 func compileTask(cmd *cobra.Command, _ []string) {
-	fmt.Println(cmd.Flags().GetString("model"))
-	fmt.Println("----------------")
-	graph := createGraph()
+	model, err := cmd.Flags().GetString("model")
+	fmt.Fprintln(config.Stdout, model, err)
+	fmt.Fprintln(config.Stdout, "----------------")
+	graph := createGraph(cmd)
+	graph.compileModels()
 	for _, node := range graph.Models {
-		fmt.Println(node.UniqueId)
-		fmt.Println(node.CompiledSql)
-		fmt.Println("----------------")
+		fmt.Fprintln(config.Stdout, node.UniqueId)
+		fmt.Fprintln(config.Stdout, node.CompiledSql)
+		fmt.Fprintln(config.Stdout, "----------------")
 	}
+
+	if !graph.hasContracts() {
+		return
+	}
+	err = graph.checkContractsOnWarehouse()
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+// checkContractsOnWarehouse compares the enforced contracts with the columns of the compiled SQL, which are
+// only known to the warehouse.
+func (g *Graph) checkContractsOnWarehouse() error {
+	adapter, err := database.NewAdapter(g.GetActiveConnection())
+	if err != nil {
+		return err
+	}
+	db, err := adapter.Open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return g.checkContracts(context.Background(), db, adapter)
 }
@@ -0,0 +1,175 @@
+package dbt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/flosch/pongo2/v4"
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/database"
+)
+
+// validateContracts checks that every model with an enforced contract declares the data types of its columns.
+func (g *Graph) validateContracts() {
+	errs := config.ValidationErrors{}
+	for _, model := range g.Models {
+		if !model.Config.Contract {
+			continue
+		}
+		if len(model.Columns) == 0 {
+			errs = append(errs, fmt.Errorf("Model '%s' has an enforced contract but no columns", model.Name))
+		}
+		for _, column := range model.Columns {
+			if column.DataType == "" {
+				errs = append(errs, fmt.Errorf("Column '%s' of model '%s' has no data_type, which is required by its contract", column.Name, model.Name))
+			}
+			for _, constraint := range column.Constraints {
+				if err := constraint.Validate(); err != nil {
+					errs = append(errs, fmt.Errorf("Column '%s' of model '%s': %v", column.Name, model.Name, err))
+				}
+			}
+		}
+		for _, constraint := range model.Constraints {
+			if err := constraint.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("Model '%s': %v", model.Name, err))
+			} else if len(constraint.Columns) == 0 {
+				errs = append(errs, fmt.Errorf("Model '%s': a %s constraint on the model needs columns", model.Name, constraint.Type))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		log.Fatal(errs)
+	}
+}
+
+// contractColumns converts the contract of a model for the adapter, rendering the relations foreign keys refer to.
+func (g *Graph) contractColumns(model *Model) ([]database.Column, []database.Constraint, error) {
+	columns := make([]database.Column, 0, len(model.Columns))
+	for _, column := range model.Columns {
+		constraints, err := g.toConstraints(model, column.Constraints)
+		if err != nil {
+			return nil, nil, err
+		}
+		columns = append(columns, database.Column{Name: column.Name, DataType: column.DataType, Constraints: constraints})
+	}
+	constraints, err := g.toConstraints(model, model.Constraints)
+	return columns, constraints, err
+}
+
+func (g *Graph) toConstraints(model *Model, constraints []config.Constraint) ([]database.Constraint, error) {
+	converted := make([]database.Constraint, 0, len(constraints))
+	for _, constraint := range constraints {
+		to := constraint.To
+		// to is either a relation name or an expression like ref('customers')
+		if strings.HasPrefix(to, "ref(") || strings.HasPrefix(to, "source(") {
+			tpl, err := pongo2.FromString("{{ " + to + " }}")
+			if err != nil {
+				return nil, err
+			}
+			to, err = tpl.Execute(g.modelContext(model))
+			if err != nil {
+				return nil, err
+			}
+		}
+		converted = append(converted, database.Constraint{
+			Type:       constraint.Type,
+			Name:       constraint.Name,
+			Expression: constraint.Expression,
+			Columns:    constraint.Columns,
+			To:         to,
+			ToColumns:  constraint.ToColumns,
+		})
+	}
+	return converted, nil
+}
+
+// hasContracts tells whether any model has an enforced contract.
+func (g *Graph) hasContracts() bool {
+	for _, model := range g.Models {
+		if model.ResourceType == "model" && model.Config.Contract {
+			return true
+		}
+	}
+	return false
+}
+
+// checkContracts compares the compiled SQL of every model with an enforced contract with its contract, so
+// that compile reports a broken contract before any model runs.
+func (g *Graph) checkContracts(ctx context.Context, conn database.Queryer, adapter database.Adapter) error {
+	ids := make([]string, 0)
+	for id, model := range g.Models {
+		if model.ResourceType == "model" && model.Config.Contract {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	errs := config.ValidationErrors{}
+	for _, id := range ids {
+		if err := checkContract(ctx, conn, adapter, g.Models[id]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkContract compares the columns returned by the compiled SQL of a model with its contract.
+func checkContract(ctx context.Context, conn database.Queryer, adapter database.Adapter, model *Model) error {
+	var actual []database.Column
+	err := queryWithTimeout(ctx, conn, func(ctx context.Context) (err error) {
+		actual, err = adapter.ResultColumns(ctx, conn, model.CompiledSql)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Could not determine the columns of model %s: %w", model.Name, err)
+	}
+	return compareContract(adapter, model, actual)
+}
+
+func compareContract(adapter database.Adapter, model *Model, actual []database.Column) error {
+	actualTypes := make(map[string]string, len(actual))
+	for _, column := range actual {
+		actualTypes[strings.ToLower(column.Name)] = column.DataType
+	}
+	declared := make(map[string]bool, len(model.Columns))
+
+	mismatches := make([]string, 0)
+	for _, column := range model.Columns {
+		name := strings.ToLower(column.Name)
+		declared[name] = true
+		actualType, ok := actualTypes[name]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("column '%s' is missing from the query", column.Name))
+		} else if !adapter.SameDataType(column.DataType, actualType) {
+			mismatches = append(mismatches, fmt.Sprintf("column '%s' has data type %s in the query but %s in the contract", column.Name, actualType, column.DataType))
+		}
+	}
+	for _, column := range actual {
+		if !declared[strings.ToLower(column.Name)] {
+			mismatches = append(mismatches, fmt.Sprintf("column '%s' of the query is missing from the contract", column.Name))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("The enforced contract of model %s failed:\n  %s", model.Name, strings.Join(mismatches, "\n  "))
+	}
+	return nil
+}
+
+// materializationQueries returns the statements creating the relation of a model.
+func (g *Graph) materializationQueries(adapter database.Adapter, model *Model) ([]string, error) {
+	relation := model.fqn().String()
+	if !model.Config.Contract {
+		query, err := adapter.MaterializationQuery(model.Config.Materialization, relation, model.CompiledSql, model.Config.CopyGrants)
+		return []string{query}, err
+	}
+	columns, constraints, err := g.contractColumns(model)
+	if err != nil {
+		return nil, err
+	}
+	return adapter.ContractQueries(model.Config.Materialization, relation, columns, constraints, model.CompiledSql, model.Config.CopyGrants)
+}
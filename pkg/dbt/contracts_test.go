@@ -0,0 +1,96 @@
+package dbt
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/database"
+)
+
+func TestCompareContractReportsEveryMismatch(t *testing.T) {
+	model := &Model{Name: "orders", Config: createModelConfig("table", ""), Columns: []config.ColumnProperties{
+		{Name: "id", DataType: "number(38, 0)"},
+		{Name: "status", DataType: "varchar"},
+		{Name: "amount", DataType: "float"},
+	}}
+	actual := []database.Column{
+		{Name: "ID", DataType: "FIXED"},
+		{Name: "STATUS", DataType: "FIXED"},
+		{Name: "ORDERED_AT", DataType: "TIMESTAMP_NTZ"},
+	}
+
+	err := compareContract(&database.Snowflake{}, model, actual)
+	if err == nil {
+		t.Fatal("expected the contract to fail")
+	}
+	for _, expected := range []string{"'status' has data type FIXED", "'amount' is missing from the query", "'ORDERED_AT' of the query is missing"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s not in %v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "'id'") {
+		t.Error(err)
+	}
+}
+
+func TestMaterializationQueriesOfAnEnforcedContract(t *testing.T) {
+	g := &Graph{Models: map[string]*Model{}}
+	model := &Model{
+		Name:     "orders",
+		Database: "analytics",
+		Schema:   "marts",
+		Config:   &ModelConfig{Materialization: "table", Contract: true},
+		Columns: []config.ColumnProperties{
+			{Name: "id", DataType: "number", Constraints: []config.Constraint{{Type: "not_null"}, {Type: "primary_key"}}},
+			{Name: "amount", DataType: "float", Constraints: []config.Constraint{{Type: "check", Expression: "amount > 0"}}},
+		},
+		Constraints: []config.Constraint{{Type: "unique", Name: "uq_orders", Columns: []string{"id", "amount"}}},
+		CompiledSql: "select 1 as id, 1.0 as amount",
+	}
+
+	statements, err := g.materializationQueries(&database.Snowflake{}, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"create or replace table analytics.marts.orders (\n    id number not null primary key,\n    amount float,\n    constraint uq_orders unique (id, amount)\n)",
+		"insert into analytics.marts.orders (id, amount)\nselect id, amount from (\nselect 1 as id, 1.0 as amount\n) as model_subq",
+	}
+	if len(statements) != len(expected) {
+		t.Fatal(statements)
+	}
+	for i := range expected {
+		if statements[i] != expected[i] {
+			t.Errorf("expected\n%s\ngot\n%s", expected[i], statements[i])
+		}
+	}
+}
+
+func TestCheckContractsComparesEveryModelWithAContract(t *testing.T) {
+	fake := &tableDriver{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	contract := func(name string, columns ...config.ColumnProperties) *Model {
+		return &Model{Name: name, UniqueId: "model.demo." + name, ResourceType: "model", Config: &ModelConfig{Materialization: "table", Contract: true}, Columns: columns, CompiledSql: "select * from payments"}
+	}
+	g := &Graph{Models: map[string]*Model{
+		"model.demo.payments": contract("payments", config.ColumnProperties{Name: "payment_method", DataType: "varchar"}, config.ColumnProperties{Name: "amount", DataType: "number"}),
+		"model.demo.amounts":  contract("amounts", config.ColumnProperties{Name: "amount", DataType: "float"}),
+		"model.demo.free":     {Name: "free", ResourceType: "model", Config: createModelConfig("view", ""), CompiledSql: "select 1"},
+	}}
+	if !g.hasContracts() {
+		t.Fatal("expected the contracts to be found")
+	}
+
+	err := g.checkContracts(context.Background(), db, &database.Snowflake{})
+	if err == nil || !strings.Contains(err.Error(), "model amounts failed") || strings.Contains(err.Error(), "model payments") {
+		t.Error(err)
+	}
+	if len(fake.statements) != 2 {
+		t.Error("expected only the models with a contract to be queried", fake.statements)
+	}
+}
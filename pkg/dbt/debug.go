@@ -0,0 +1,117 @@
+package dbt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+type debugCheck struct {
+	name string
+	errs []error
+}
+
+func debugTask(cmd *cobra.Command, _ []string) {
+	checks := make([]debugCheck, 0)
+	check := func(name string, errs ...error) bool {
+		current := debugCheck{name: name, errs: make([]error, 0)}
+		for _, err := range errs {
+			if err != nil {
+				current.errs = append(current.errs, err)
+			}
+		}
+		checks = append(checks, current)
+		fmt.Fprintln(config.Stdout, formatDebugCheck(current))
+		return len(current.errs) == 0
+	}
+	defer func() {
+		failed := 0
+		for _, check := range checks {
+			if len(check.errs) > 0 {
+				failed++
+			}
+		}
+		if failed > 0 {
+			fmt.Fprintf(config.Stdout, "\n%d of %d checks failed\n", failed, len(checks))
+			os.Exit(1)
+		}
+		fmt.Fprintf(config.Stdout, "\nAll %d checks passed!\n", len(checks))
+	}()
+
+	projectDir, _ := cmd.Flags().GetString("project-dir")
+	profilesDir, _ := cmd.Flags().GetString("profiles-dir")
+	profilesDir = config.FindProfilesDir(profilesDir, projectDir)
+
+	fmt.Fprintln(config.Stdout, "Configuration:")
+	fmt.Fprintln(config.Stdout, "  dbt_project.yml:", filepath.Join(projectDir, "dbt_project.yml"))
+	fmt.Fprintln(config.Stdout, "  profiles.yml:   ", filepath.Join(profilesDir, "profiles.yml"))
+	fmt.Fprintln(config.Stdout)
+
+	projectConfig, err := config.LoadConfig(projectDir)
+	if !check("dbt_project.yml file found and valid", err) {
+		return
+	}
+
+	profiles, err := config.LoadProfiles(profilesDir)
+	if !check("profiles.yml file found and valid", err) {
+		return
+	}
+	profileName, _ := cmd.Flags().GetString("profile")
+	if profileName == "" {
+		profileName = projectConfig.Profile
+	}
+	target, _ := cmd.Flags().GetString("target")
+	connection, err := profiles.Connection(profileName, target)
+	if !check(fmt.Sprintf("profile '%s' and target found", profileName), err) {
+		return
+	}
+	if !check("target settings are valid", connection.Validate()...) {
+		return
+	}
+
+	fmt.Fprintln(config.Stdout)
+	fmt.Fprintln(config.Stdout, "Connection:")
+	fmt.Fprintf(config.Stdout, "  %+v\n", connection.Masked())
+	fmt.Fprintln(config.Stdout)
+
+	if connection.AuthenticatorName() == "jwt" {
+		_, err := database.ReadPrivateKey(connection)
+		if !check(fmt.Sprintf("private key %s can be decoded", firstNonEmpty(connection.PrivateKeyPath, "private_key")), err) {
+			return
+		}
+	}
+
+	db, err := database.Open(connection)
+	if !check("connection can be configured", err) {
+		return
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if !check("connection can be opened", db.PingContext(ctx)) {
+		return
+	}
+	_, err = db.ExecContext(ctx, "select 1")
+	check("connection can run a query", err)
+}
+
+func formatDebugCheck(check debugCheck) string {
+	if len(check.errs) == 0 {
+		return fmt.Sprintf("  [OK]    %s", check.name)
+	}
+	result := fmt.Sprintf("  [ERROR] %s", check.name)
+	for _, err := range check.errs {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			result += fmt.Sprintf("\n          %s", line)
+		}
+	}
+	return result
+}
@@ -0,0 +1,210 @@
+package dbt
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+type packageInstaller struct {
+	installPath string
+	installed   map[string]string // package name -> location it was installed from
+}
+
+func depsTask(cmd *cobra.Command, _ []string) {
+	projectDir, _ := cmd.Flags().GetString("project-dir")
+	projectConfig := config.ReadConfig(projectDir)
+	installPath := filepath.Join(projectDir, firstNonEmpty(projectConfig.PackagesInstallPath, projectConfig.ModulesPath, "dbt_packages"))
+
+	installed, err := installPackages(projectDir, projectConfig, installPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for name, location := range installed {
+		fmt.Fprintf(config.Stdout, "Installed %s from %s\n", name, location)
+	}
+	fmt.Fprintf(config.Stdout, "Installed %d packages into %s\n", len(installed), installPath)
+}
+
+// installPackages installs the packages of the project, and their dependencies, into a clean installPath.
+func installPackages(projectDir string, projectConfig config.Config, installPath string) (map[string]string, error) {
+	err := checkInstallPath(projectDir, projectConfig, installPath)
+	if err != nil {
+		return nil, err
+	}
+	err = os.RemoveAll(installPath)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(installPath, 0755)
+	if err != nil {
+		return nil, err
+	}
+	installer := packageInstaller{
+		installPath: installPath,
+		installed:   make(map[string]string),
+	}
+	err = installer.installAll(projectDir)
+	return installer.installed, err
+}
+
+// checkInstallPath guards the removal of the install path, which has to be a directory of its own inside
+// the project and can't overlap with the directories of the resources.
+func checkInstallPath(projectDir string, projectConfig config.Config, installPath string) error {
+	project, err := filepath.Abs(projectDir)
+	if err != nil {
+		return err
+	}
+	install, err := filepath.Abs(installPath)
+	if err != nil {
+		return err
+	}
+	if !isInside(project, install) {
+		return fmt.Errorf("The packages-install-path %s must be a directory inside the project %s", installPath, projectDir)
+	}
+	resourcePaths := [][]string{
+		defaultPaths(projectConfig.ModelPaths, defaultPaths(projectConfig.SourcePaths, "models")...),
+		defaultPaths(projectConfig.SeedPaths, defaultPaths(projectConfig.DataPaths, "seeds")...),
+		defaultPaths(projectConfig.TestPaths, "tests"),
+		defaultPaths(projectConfig.AnalysisPaths, "analyses"),
+		defaultPaths(projectConfig.MacroPaths, "macros"),
+		defaultPaths(projectConfig.SnapshotPaths, "snapshots"),
+		defaultPaths(projectConfig.DocsPaths),
+		defaultPaths(projectConfig.AssetPaths),
+	}
+	for _, paths := range resourcePaths {
+		for _, path := range paths {
+			resource := filepath.Join(project, path)
+			if isInside(resource, install) || isInside(install, resource) || resource == install {
+				return fmt.Errorf("The packages-install-path %s overlaps with the resource path %s", installPath, path)
+			}
+		}
+	}
+	return nil
+}
+
+// isInside tells whether path is a directory below dir.
+func isInside(dir string, path string) bool {
+	relative, err := filepath.Rel(dir, path)
+	return err == nil && relative != "." && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+func (installer *packageInstaller) installAll(projectDir string) error {
+	packages, err := config.LoadPackages(projectDir)
+	if err != nil {
+		return err
+	}
+	for _, dependency := range packages.Packages {
+		err := installer.install(projectDir, dependency)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (installer *packageInstaller) install(projectDir string, dependency config.Package) error {
+	var sourceDir, location string
+	if dependency.Local != "" {
+		sourceDir = dependency.Local
+		if !filepath.IsAbs(sourceDir) {
+			sourceDir = filepath.Join(projectDir, sourceDir)
+		}
+		location = sourceDir
+	} else {
+		checkoutDir, err := ioutil.TempDir("", "dbt-package-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(checkoutDir)
+
+		err = checkout(dependency.Git, dependency.Revision, checkoutDir)
+		if err != nil {
+			return err
+		}
+		sourceDir = filepath.Join(checkoutDir, dependency.Subdirectory)
+		location = dependency.Git
+		if dependency.Revision != "" {
+			location = fmt.Sprintf("%s@%s", dependency.Git, dependency.Revision)
+		}
+	}
+
+	packageConfig, err := config.LoadConfig(sourceDir)
+	if err != nil {
+		return fmt.Errorf("Package %s is not a dbt project: %v", location, err)
+	}
+	if previous, seen := installer.installed[packageConfig.Name]; seen {
+		if previous != location {
+			log.Printf("Warning: package %s is required from both %s and %s, keeping the first", packageConfig.Name, previous, location)
+		}
+		return nil
+	}
+
+	err = copyDir(sourceDir, filepath.Join(installer.installPath, packageConfig.Name))
+	if err != nil {
+		return err
+	}
+	installer.installed[packageConfig.Name] = location
+
+	// install the dependencies of the package as well
+	return installer.installAll(sourceDir)
+}
+
+func checkout(repository string, revision string, dir string) error {
+	commands := [][]string{{"git", "clone", "--quiet", repository, dir}}
+	if revision != "" {
+		commands = append(commands, []string{"git", "-C", dir, "checkout", "--quiet", revision})
+	}
+	for _, command := range commands {
+		output, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("Could not checkout %s: %v\n%s", repository, err, output)
+		}
+	}
+	return nil
+}
+
+// copyDir copies the content of source into target, leaving out the git metadata.
+func copyDir(source string, target string) error {
+	return filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		relativePath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		targetPath := filepath.Join(target, relativePath)
+		if d.IsDir() {
+			return os.MkdirAll(targetPath, 0755)
+		}
+		return copyFile(path, targetPath)
+	})
+}
+
+func copyFile(source string, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,96 @@
+package dbt
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func git(t *testing.T, dir string, args ...string) {
+	args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatal(err, string(output))
+	}
+}
+
+func TestInstallPackagesFromLocalPathAndGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "deps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a git package with a transitive local dependency, pushed to a bare repository
+	writeFiles(t, filepath.Join(dir, "utils"), map[string]string{
+		"dbt_project.yml":        "name: utils\nprofile: demo\n",
+		"macros/star.sql":        "{% macro star() %}*{% endmacro %}",
+		"packages.yml":           "packages:\n  - local: nested\n",
+		"nested/dbt_project.yml": "name: nested\nprofile: demo\n",
+	})
+	git(t, filepath.Join(dir, "utils"), "init", "--quiet")
+	git(t, filepath.Join(dir, "utils"), "add", ".")
+	git(t, filepath.Join(dir, "utils"), "commit", "--quiet", "-m", "initial")
+	git(t, filepath.Join(dir, "utils"), "tag", "v1")
+	git(t, dir, "clone", "--quiet", "--bare", "utils", "utils.git")
+
+	writeFiles(t, filepath.Join(dir, "staging"), map[string]string{
+		"dbt_project.yml":       "name: staging\nprofile: demo\n",
+		"models/stg_orders.sql": "select 1",
+	})
+	writeFiles(t, filepath.Join(dir, "project"), map[string]string{
+		"packages.yml": "packages:\n  - local: ../staging\n  - git: " + filepath.Join(dir, "utils.git") + "\n    revision: v1\n",
+	})
+
+	installPath := filepath.Join(dir, "project", "dbt_packages")
+	installed, err := installPackages(filepath.Join(dir, "project"), config.Config{}, installPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(installed) != 3 {
+		t.Error(installed)
+	}
+	for _, path := range []string{"staging/models/stg_orders.sql", "utils/macros/star.sql", "nested/dbt_project.yml"} {
+		if _, err := os.Stat(filepath.Join(installPath, path)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(installPath, "utils", ".git")); !os.IsNotExist(err) {
+		t.Error("git metadata should not be installed")
+	}
+}
+
+func TestInstallPathMustNotRemoveTheProject(t *testing.T) {
+	projectConfig := config.Config{ModelPaths: []string{"transformations"}}
+	for _, installPath := range []string{".", "..", "transformations", "transformations/vendor"} {
+		if err := checkInstallPath("project", projectConfig, filepath.Join("project", installPath)); err == nil {
+			t.Errorf("expected %s to be rejected", installPath)
+		}
+	}
+	if err := checkInstallPath("project", projectConfig, "/tmp/dbt_packages"); err == nil {
+		t.Error("expected a path outside of the project to be rejected")
+	}
+	for _, installPath := range []string{"dbt_packages", "models", "vendor/packages"} {
+		if err := checkInstallPath("project", projectConfig, filepath.Join("project", installPath)); err != nil {
+			t.Error(err)
+		}
+	}
+}
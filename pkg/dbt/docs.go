@@ -0,0 +1,169 @@
+package dbt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+type catalogTableMetadata struct {
+	Type     string `json:"type"`
+	Database string `json:"database"`
+	Schema   string `json:"schema"`
+	Name     string `json:"name"`
+	Comment  string `json:"comment"`
+	Owner    string `json:"owner"`
+}
+
+type catalogColumn struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Name    string `json:"name"`
+	Comment string `json:"comment"`
+}
+
+type catalogStat struct {
+	Id          string      `json:"id"`
+	Label       string      `json:"label"`
+	Value       interface{} `json:"value"`
+	Include     bool        `json:"include"`
+	Description string      `json:"description"`
+}
+
+type catalogTable struct {
+	Metadata catalogTableMetadata     `json:"metadata"`
+	Columns  map[string]catalogColumn `json:"columns"`
+	Stats    map[string]catalogStat   `json:"stats"`
+	UniqueId string                   `json:"unique_id"`
+}
+
+type catalog struct {
+	Metadata artifactMetadata        `json:"metadata"`
+	Nodes    map[string]catalogTable `json:"nodes"`
+	Sources  map[string]catalogTable `json:"sources"`
+	Errors   []string                `json:"errors"`
+}
+
+// catalogRelation links a relation in the warehouse to the node it belongs to.
+type catalogRelation struct {
+	uniqueId string
+	source   bool
+}
+
+func docsGenerateTask(cmd *cobra.Command, _ []string) {
+	graph := createGraph(cmd)
+	graph.compileModels()
+	fmt.Fprintln(config.Stdout, "Wrote manifest to", graph.writeManifest())
+
+	// the catalog is the only part that needs the warehouse
+	noCatalog, _ := cmd.Flags().GetBool("no-catalog")
+	if noCatalog {
+		return
+	}
+
+	connection := graph.GetActiveConnection()
+	adapter, err := database.NewAdapter(connection)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := adapter.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	// group all relations per database so that the information schema is only queried once per database
+	relations := make(map[string]map[string]catalogRelation)
+	schemas := make(map[string]map[string]bool)
+	addRelation := func(relation Relation, node catalogRelation) {
+		databaseName := strings.ToUpper(relation.database)
+		if _, seen := relations[databaseName]; !seen {
+			relations[databaseName] = make(map[string]catalogRelation)
+			schemas[databaseName] = make(map[string]bool)
+		}
+		relations[databaseName][strings.ToUpper(relation.schema+"."+relation.object)] = node
+		schemas[databaseName][relation.schema] = true
+	}
+	for _, model := range graph.Models {
+		if model.ResourceType == "test" {
+			continue
+		}
+		addRelation(model.fqn(), catalogRelation{uniqueId: model.UniqueId})
+	}
+	for _, source := range graph.Sources {
+		addRelation(source.fqn(), catalogRelation{uniqueId: source.UniqueId, source: true})
+	}
+
+	catalog := catalog{
+		Metadata: graph.artifactMetadata("https://schemas.getdbt.com/dbt/catalog/v1.json"),
+		Nodes:    make(map[string]catalogTable),
+		Sources:  make(map[string]catalogTable),
+	}
+	for databaseName, databaseSchemas := range schemas {
+		schemaNames := make([]string, 0, len(databaseSchemas))
+		for schema := range databaseSchemas {
+			schemaNames = append(schemaNames, schema)
+		}
+		columns, err := adapter.Catalog(context.Background(), db, databaseName, schemaNames)
+		if err != nil {
+			catalog.Errors = append(catalog.Errors, fmt.Sprintf("Could not introspect database %s: %v", databaseName, err))
+			continue
+		}
+		for _, column := range columns {
+			node, seen := relations[databaseName][strings.ToUpper(column.Schema+"."+column.Table)]
+			if !seen {
+				continue
+			}
+			tables := catalog.Nodes
+			if node.source {
+				tables = catalog.Sources
+			}
+			table, seen := tables[node.uniqueId]
+			if !seen {
+				table = toCatalogTable(node.uniqueId, column)
+			}
+			table.Columns[column.Column] = catalogColumn{
+				Type:    column.DataType,
+				Index:   column.Index,
+				Name:    column.Column,
+				Comment: column.ColumnComment,
+			}
+			tables[node.uniqueId] = table
+		}
+	}
+
+	fmt.Fprintln(config.Stdout, "Wrote catalog to", graph.writeArtifact("catalog.json", catalog))
+	if len(catalog.Errors) > 0 {
+		log.Fatal(strings.Join(catalog.Errors, "\n"))
+	}
+}
+
+func toCatalogTable(uniqueId string, column database.CatalogColumn) catalogTable {
+	stats := map[string]catalogStat{
+		"has_stats": {Id: "has_stats", Label: "Has Stats?", Value: column.RowCount.Valid || column.Bytes.Valid, Description: "Indicates whether there are statistics for this table"},
+	}
+	if column.RowCount.Valid {
+		stats["row_count"] = catalogStat{Id: "row_count", Label: "Row Count", Value: column.RowCount.Int64, Include: true, Description: "An approximate count of rows in this table"}
+	}
+	if column.Bytes.Valid {
+		stats["bytes"] = catalogStat{Id: "bytes", Label: "Approximate Size", Value: column.Bytes.Int64, Include: true, Description: "Approximate size of the table as reported by the warehouse"}
+	}
+	return catalogTable{
+		Metadata: catalogTableMetadata{
+			Type:     column.TableType,
+			Database: column.Database,
+			Schema:   column.Schema,
+			Name:     column.Table,
+			Comment:  column.TableComment,
+			Owner:    column.TableOwner,
+		},
+		Columns:  make(map[string]catalogColumn),
+		Stats:    stats,
+		UniqueId: uniqueId,
+	}
+}
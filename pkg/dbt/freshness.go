@@ -0,0 +1,201 @@
+package dbt
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/dag"
+	"github.com/mdesmet/go-dbt/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+const (
+	freshnessPass         = "pass"
+	freshnessWarn         = "warn"
+	freshnessError        = "error"
+	freshnessRuntimeError = "runtime error"
+)
+
+type freshnessThreshold struct {
+	Count  int    `json:"count"`
+	Period string `json:"period"`
+}
+
+type freshnessCriteria struct {
+	WarnAfter  *freshnessThreshold `json:"warn_after"`
+	ErrorAfter *freshnessThreshold `json:"error_after"`
+	Filter     string              `json:"filter,omitempty"`
+}
+
+type freshnessResult struct {
+	UniqueId              string            `json:"unique_id"`
+	MaxLoadedAt           *time.Time        `json:"max_loaded_at,omitempty"`
+	SnapshottedAt         *time.Time        `json:"snapshotted_at,omitempty"`
+	MaxLoadedAtTimeAgoInS float64           `json:"max_loaded_at_time_ago_in_s"`
+	Status                string            `json:"status"`
+	Criteria              freshnessCriteria `json:"criteria"`
+	Error                 string            `json:"error,omitempty"`
+	ThreadId              string            `json:"thread_id"`
+	ExecutionTime         float64           `json:"execution_time"`
+}
+
+type sourcesArtifact struct {
+	Metadata    artifactMetadata  `json:"metadata"`
+	Results     []freshnessResult `json:"results"`
+	ElapsedTime float64           `json:"elapsed_time"`
+}
+
+func freshnessTask(cmd *cobra.Command, _ []string) {
+	start := time.Now()
+	graph := createGraph(cmd)
+	selection, _ := cmd.Flags().GetString("select")
+	sources := graph.selectSources(selection)
+
+	connection := graph.GetActiveConnection()
+	adapter, err := database.NewAdapter(connection)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := adapter.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	numThreads := connection.Threads
+	if numThreads < 1 {
+		numThreads = 1
+	}
+	results := make([]freshnessResult, len(sources))
+	threads := make(chan int, numThreads)
+	for thread := 1; thread <= numThreads; thread++ {
+		threads <- thread
+	}
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source *Source) {
+			defer wg.Done()
+			thread := <-threads
+			defer func() { threads <- thread }()
+
+			fmt.Fprintf(config.Stdout, "%d of %d START freshness of %s.%s\n", i+1, len(sources), source.SourceName, source.Name)
+			results[i] = checkFreshness(adapter, db, source)
+			results[i].ThreadId = fmt.Sprintf("Thread-%d", thread)
+			fmt.Fprintf(config.Stdout, "%d of %d %s freshness of %s.%s %s\n", i+1, len(sources), strings.ToUpper(results[i].Status), source.SourceName, source.Name, results[i].Error)
+		}(i, source)
+	}
+	wg.Wait()
+
+	path := graph.writeArtifact("sources.json", sourcesArtifact{
+		Metadata:    graph.artifactMetadata("https://schemas.getdbt.com/dbt/sources/v3.json"),
+		Results:     results,
+		ElapsedTime: time.Since(start).Seconds(),
+	})
+	fmt.Fprintln(config.Stdout, "Done. Wrote output to", path)
+
+	for _, result := range results {
+		if result.Status == freshnessError || result.Status == freshnessRuntimeError {
+			os.Exit(1)
+		}
+	}
+}
+
+// selectSources returns the selected sources that have both a loaded_at_field and a freshness configured.
+func (g *Graph) selectSources(selection string) []*Source {
+	selectionDag := dag.CreateDag()
+	populateDag(g, selectionDag)
+	selectionDag, err := selectionDag.ApplySelection(selection)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sources := make([]*Source, 0)
+	for _, source := range g.Sources {
+		if !selectionDag.Contains(source.selector()) {
+			continue
+		}
+		if source.LoadedAtField == "" || source.Freshness == nil {
+			continue
+		}
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].UniqueId < sources[j].UniqueId
+	})
+	return sources
+}
+
+func checkFreshness(adapter database.Adapter, db *sql.DB, source *Source) (result freshnessResult) {
+	start := time.Now()
+	result = freshnessResult{
+		UniqueId: source.UniqueId,
+		Criteria: freshnessCriteria{
+			WarnAfter:  toFreshnessThreshold(source.Freshness.WarnAfter),
+			ErrorAfter: toFreshnessThreshold(source.Freshness.ErrorAfter),
+			Filter:     source.Freshness.Filter,
+		},
+	}
+	defer func() {
+		result.ExecutionTime = time.Since(start).Seconds()
+	}()
+
+	var maxLoadedAtOrNull sql.NullTime
+	var snapshottedAt time.Time
+	query := adapter.FreshnessQuery(source.fqn().String(), source.LoadedAtField, source.Freshness.Filter)
+	err := db.QueryRowContext(context.Background(), query).Scan(&maxLoadedAtOrNull, &snapshottedAt)
+	if err == nil && !maxLoadedAtOrNull.Valid {
+		err = fmt.Errorf("%s has no rows with a %s, so its freshness is unknown", source.fqn(), source.LoadedAtField)
+	}
+	if err != nil {
+		result.Status = freshnessRuntimeError
+		result.Error = err.Error()
+		return result
+	}
+	maxLoadedAt := maxLoadedAtOrNull.Time
+	result.MaxLoadedAt = &maxLoadedAt
+	result.SnapshottedAt = &snapshottedAt
+	age := snapshottedAt.Sub(maxLoadedAt)
+	result.MaxLoadedAtTimeAgoInS = age.Seconds()
+
+	result.Status, err = freshnessStatus(source.Freshness, age)
+	if err != nil {
+		result.Status = freshnessRuntimeError
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func freshnessStatus(freshness *config.Freshness, age time.Duration) (string, error) {
+	for _, check := range []struct {
+		threshold *config.FreshnessThreshold
+		status    string
+	}{{freshness.ErrorAfter, freshnessError}, {freshness.WarnAfter, freshnessWarn}} {
+		if check.threshold == nil {
+			continue
+		}
+		maxAge, err := check.threshold.Duration()
+		if err != nil {
+			return "", err
+		}
+		if age > maxAge {
+			return check.status, nil
+		}
+	}
+	return freshnessPass, nil
+}
+
+func toFreshnessThreshold(threshold *config.FreshnessThreshold) *freshnessThreshold {
+	if threshold == nil {
+		return nil
+	}
+	return &freshnessThreshold{Count: threshold.Count, Period: threshold.Period}
+}
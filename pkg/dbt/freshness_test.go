@@ -0,0 +1,73 @@
+package dbt
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/database"
+)
+
+func TestFreshnessStatus(t *testing.T) {
+	freshness := &config.Freshness{
+		WarnAfter:  &config.FreshnessThreshold{Count: 12, Period: "hour"},
+		ErrorAfter: &config.FreshnessThreshold{Count: 1, Period: "day"},
+	}
+	for age, expected := range map[time.Duration]string{
+		time.Hour:      freshnessPass,
+		13 * time.Hour: freshnessWarn,
+		25 * time.Hour: freshnessError,
+	} {
+		status, err := freshnessStatus(freshness, age)
+		if err != nil || status != expected {
+			t.Errorf("%v: expected %s, got %s %v", age, expected, status, err)
+		}
+	}
+
+	// error_after wins when it is shorter than warn_after
+	shorter := &config.Freshness{
+		WarnAfter:  &config.FreshnessThreshold{Count: 1, Period: "day"},
+		ErrorAfter: &config.FreshnessThreshold{Count: 1, Period: "hour"},
+	}
+	if status, err := freshnessStatus(shorter, 2*time.Hour); err != nil || status != freshnessError {
+		t.Error(status, err)
+	}
+
+	invalid := &config.Freshness{WarnAfter: &config.FreshnessThreshold{Count: 1, Period: "week"}}
+	if _, err := freshnessStatus(invalid, time.Hour); err == nil {
+		t.Error("expected an invalid period to fail")
+	}
+}
+
+func TestCheckFreshness(t *testing.T) {
+	snapshottedAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := &tableDriver{
+		columns: []string{"max_loaded_at", "snapshotted_at"},
+		rows:    [][]driver.Value{{snapshottedAt.Add(-13 * time.Hour), snapshottedAt}},
+	}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	source := &Source{
+		UniqueId:      "source.shop.raw.orders",
+		Database:      "raw",
+		Schema:        "shop",
+		Object:        "orders",
+		LoadedAtField: "_loaded_at",
+		Freshness:     &config.Freshness{WarnAfter: &config.FreshnessThreshold{Count: 12, Period: "hour"}},
+	}
+
+	result := checkFreshness(&database.Snowflake{}, db, source)
+	if result.Status != freshnessWarn || result.MaxLoadedAtTimeAgoInS != (13*time.Hour).Seconds() || result.ExecutionTime <= 0 {
+		t.Errorf("%+v", result)
+	}
+
+	// the max(loaded_at_field) of an empty table is null
+	fake.rows = [][]driver.Value{{nil, snapshottedAt}}
+	result = checkFreshness(&database.Snowflake{}, db, source)
+	if result.Status != freshnessRuntimeError || !strings.Contains(result.Error, "raw.shop.orders has no rows with a _loaded_at") {
+		t.Errorf("%+v", result)
+	}
+}
@@ -0,0 +1,136 @@
+package dbt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/dag"
+	"github.com/mdesmet/go-dbt/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+// relationType is the kind of object a materialization creates, as used in GRANT statements.
+func relationType(materialization string) string {
+	if materialization == "view" {
+		return "view"
+	}
+	return "table"
+}
+
+// grantStatements returns the GRANT and REVOKE statements bringing the current grants of a model
+// in line with its grants config. Privileges missing from the config are revoked completely.
+func grantStatements(adapter database.Adapter, model *Model, current map[string][]string) []string {
+	relation := model.fqn().String()
+	objectType := relationType(model.Config.Materialization)
+
+	statements := make([]string, 0)
+	for _, privilege := range sortedKeys(model.Config.Grants) {
+		granted := toSet(current[privilege])
+		for _, grantee := range model.Config.Grants[privilege] {
+			if !granted[grantee] {
+				statements = append(statements, adapter.GrantQuery(objectType, relation, privilege, grantee))
+			}
+		}
+	}
+	for _, privilege := range sortedKeys(current) {
+		desired := toSet(model.Config.Grants[privilege])
+		for _, grantee := range current[privilege] {
+			if !desired[grantee] {
+				statements = append(statements, adapter.RevokeQuery(objectType, relation, privilege, grantee))
+			}
+		}
+	}
+	return statements
+}
+
+// applyGrants diffs the grants config of a model against the grants on its relation and issues
+// only the statements needed. Nothing happens when the model has no grants config.
+func applyGrants(ctx context.Context, conn database.Queryer, adapter database.Adapter, model *Model, dryRun bool) error {
+	if model.Config.Grants == nil {
+		return nil
+	}
+	var current map[string][]string
+	err := queryWithTimeout(ctx, conn, func(ctx context.Context) (err error) {
+		current, err = adapter.CurrentGrants(ctx, conn, model.fqn().String())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Could not show the grants on %s: %w", model.fqn(), err)
+	}
+	for _, statement := range grantStatements(adapter, model, current) {
+		fmt.Fprintln(config.Stdout, statement)
+		if dryRun {
+			continue
+		}
+		_, err := conn.ExecContext(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("An error occurred while applying the grants of model %s: %w", model.Name, err)
+		}
+	}
+	return nil
+}
+
+// grantsTask applies the grants config to the existing relations of the selected models, without
+// running them. With --dry-run the statements are only printed.
+func grantsTask(cmd *cobra.Command, _ []string) {
+	dag := dag.CreateDag()
+	graph := createGraph(cmd)
+	populateDag(graph, dag)
+
+	selection, _ := cmd.Flags().GetString("model")
+	dag, err := dag.ApplySelection(selection)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keepResourceTypes(dag, graph, "model", "seed", "snapshot")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	names := dag.Vertices()
+	sort.Strings(names)
+	err = graph.applyGrantsOnWarehouse(names, dryRun)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+// applyGrantsOnWarehouse applies the grants of the given nodes, in order, stopping at the first failure.
+func (g *Graph) applyGrantsOnWarehouse(ids []string, dryRun bool) error {
+	adapter, err := database.NewAdapter(g.GetActiveConnection())
+	if err != nil {
+		return err
+	}
+	db, err := adapter.Open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	for _, id := range ids {
+		err := applyGrants(context.Background(), db, adapter, g.Models[id], dryRun)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
@@ -0,0 +1,44 @@
+package dbt
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mdesmet/go-dbt/pkg/database"
+)
+
+func TestGrantStatementsOnlyIssueTheDifference(t *testing.T) {
+	model := &Model{Name: "orders", Database: "analytics", Schema: "marts", Config: createModelConfig("table", "")}
+	err := model.Config.apply("+grants", map[string]interface{}{"SELECT": []interface{}{"Reporter", "analyst"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := map[string][]string{
+		"select": {"reporter", "intern"},
+		"insert": {"loader"},
+	}
+
+	statements := grantStatements(&database.Snowflake{}, model, current)
+
+	expected := []string{
+		"grant select on table analytics.marts.orders to role analyst",
+		"revoke insert on table analytics.marts.orders from role loader",
+		"revoke select on table analytics.marts.orders from role intern",
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Error(statements)
+	}
+}
+
+func TestGrantsConfigShouldMapPrivilegesToGrantees(t *testing.T) {
+	config := createModelConfig("view", "")
+	if err := config.apply("grants", []interface{}{"reporter"}); err == nil {
+		t.Error()
+	}
+	if err := config.apply("grants", map[string]interface{}{"select": "reporter"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config.Grants, map[string][]string{"select": {"reporter"}}) {
+		t.Error(config.Grants)
+	}
+}
@@ -1,20 +1,45 @@
 package dbt
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
 	"log"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/flosch/pongo2/v4"
+	"github.com/google/uuid"
 	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/dag"
+	"github.com/mdesmet/go-dbt/pkg/database"
+	"github.com/spf13/cobra"
 )
 
 type ModelConfig struct {
 	Materialization string
 	Alias           string
+	PreHooks        []string
+	PostHooks       []string
+	Grants          map[string][]string // the grantees per privilege, nil when grants are not managed
+	CopyGrants      bool
+	Contract        bool              // whether the contract of the model is enforced
+	Priority        int               // models with a higher priority are run first when they are ready
+	Retries         *int              // overrides the retries of the profile
+	RetryDelay      *int              // overrides the retry_delay of the profile
+	Timeout         *int              // overrides the query_timeout of the profile
+	Severity        string            // tests: error or warn
+	UniqueKey       string            // snapshots
+	Strategy        string            // snapshots: only timestamp is supported
+	UpdatedAt       string            // snapshots
+	TargetSchema    string            // snapshots
+	TargetDatabase  string            // snapshots
+	ColumnTypes     map[string]string // seeds: the data types of the columns, by default they are inferred
+	QueryTag        string            // overrides the query_tag of the profile while the node runs
 }
 
 func createModelConfig(materialization string, alias string) *ModelConfig {
@@ -25,156 +50,539 @@ func createModelConfig(materialization string, alias string) *ModelConfig {
 	return &modelConfig
 }
 
+// Model is a node of the graph, a model or another resource type that ref() can refer to or that
+// depends on one, like seeds, snapshots and tests.
 type Model struct {
-	UniqueId    string
-	Name        string
-	DirEntry    fs.DirEntry
-	RawSql      string
-	CompiledSql string
-	Children    map[string]bool
-	Parents     map[string]bool
-	Config      *ModelConfig
+	UniqueId     string
+	ResourceType string // model, seed, snapshot or test
+	Name         string
+	Package      string
+	RootPath     string // the root directory of the package
+	DirEntry     fs.DirEntry
+	Path         string
+	Database     string
+	Schema       string
+	RawSql       string
+	CompiledSql  string
+	Children     map[string]bool // the unique ids of the nodes depending on this one
+	Parents      map[string]bool // the unique ids of the nodes this one depends on
+	Sources      map[string]bool // the selectors of the sources this model depends on
+	Config       *ModelConfig
+	Description  string
+	Columns      []config.ColumnProperties
+	Constraints  []config.Constraint // the model level constraints of its contract
+	Meta         map[string]interface{}
+	Tags         []string
+	Docs         config.Docs
+	Tests        []interface{}
+	PatchPath    string // the property file describing this model
+	TestedNode   string // for tests, the unique id of the node or the selector of the source it tests
+	quoting      quoting
 }
 
 type Relation struct {
 	database string
 	schema   string
 	object   string
+	quoting  quoting
 }
 
+type quoting struct {
+	database   bool
+	schema     bool
+	identifier bool
+}
+
+// Source is a single table of a source, which is a node in the graph just like a model.
 type Source struct {
-	Database string
-	Schema   string
-	Object   string
+	UniqueId      string
+	SourceName    string
+	Name          string
+	Package       string
+	RootPath      string
+	Path          string
+	Database      string
+	Schema        string
+	Object        string // the identifier of the table in the warehouse
+	Quoting       quoting
+	LoadedAtField string
+	Freshness     *config.Freshness
+	Loader        string
+	Description   string
+	Meta          map[string]interface{}
+	Tags          []string
+	Columns       []config.ColumnProperties
+	Tests         []interface{}
+	Children      map[string]bool
 }
 
 func (r Relation) String() string {
-	return fmt.Sprintf("%s.%s.%s", r.database, r.schema, r.object)
+	return fmt.Sprintf("%s.%s.%s", quote(r.database, r.quoting.database), quote(r.schema, r.quoting.schema), quote(r.object, r.quoting.identifier))
+}
+
+func quote(identifier string, quoted bool) string {
+	if !quoted {
+		return identifier
+	}
+	return fmt.Sprintf(`"%s"`, strings.ReplaceAll(identifier, `"`, `""`))
 }
 
 func (model Model) fqn() Relation {
 	return Relation{
-		database: "test",
-		schema:   "test",
-		object:   model.Name,
+		database: firstNonEmpty(model.Config.TargetDatabase, model.Database),
+		schema:   firstNonEmpty(model.Config.TargetSchema, model.Schema),
+		object:   model.alias(),
+		quoting:  model.quoting,
 	}
 }
 
+// alias is the name of the relation the model materializes into.
+func (model Model) alias() string {
+	if model.Config.Alias != "" {
+		return model.Config.Alias
+	}
+	return model.Name
+}
+
 func (source Source) fqn() Relation {
 	return Relation{
 		database: source.Database,
 		schema:   source.Schema,
 		object:   source.Object,
+		quoting:  source.Quoting,
 	}
 }
 
+// selector is the name of the source in the dag, e.g. source:package.name.table, which is matched by selections
+// like source:name.table+
+func (source Source) selector() string {
+	return fmt.Sprintf("%s%s.%s.%s", dag.SourcePrefix, source.Package, source.SourceName, source.Name)
+}
+
 type Graph struct {
-	Models        map[string]*Model
+	Models        map[string]*Model // all nodes by unique id
 	ProjectConfig config.Config
 	Profiles      config.Profiles
-	Sources       map[string]map[string]Source
+	Sources       map[string]*Source // all sources by unique id
+	Vars          map[string]interface{}
+	ProjectDir    string
+	ProfileName   string
+	Target        string
+	InvocationId  string
+	Macros        map[string]*Macro // all macros by unique id
+	macroSql      string
+	warnError     warnError
+	gitSha        string // the commit of the project during a run, for the query comment
 }
 
-func createGraph() *Graph {
+func createGraph(cmd *cobra.Command) *Graph {
 	graph := Graph{
 		Models:  make(map[string]*Model),
-		Sources: make(map[string]map[string]Source),
+		Sources: make(map[string]*Source),
+		Vars:    make(map[string]interface{}),
+		Macros:  make(map[string]*Macro),
+
+		InvocationId: uuid.New().String(),
 	}
 
+	graph.ProjectDir, _ = cmd.Flags().GetString("project-dir")
+	graph.parseWarnError(cmd)
 	graph.parseProjectConfig()
-	graph.parseProfiles()
+	graph.parseProfiles(cmd)
+	graph.parseVars(cmd)
 	graph.discoverResources()
 	graph.parseModels()
+	graph.validateContracts()
 	return &graph
 }
 
 func (g *Graph) parseProjectConfig() {
-	g.ProjectConfig = config.ReadConfig()
+	g.ProjectConfig = config.ReadConfig(g.ProjectDir)
+	for _, deprecation := range g.ProjectConfig.Deprecations() {
+		err := g.warn(deprecatedConfig, "dbt_project.yml: "+deprecation)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func (g *Graph) parseProfiles(cmd *cobra.Command) {
+	profilesDir, _ := cmd.Flags().GetString("profiles-dir")
+	g.Profiles = config.ReadProfiles(config.FindProfilesDir(profilesDir, g.ProjectDir))
+
+	g.ProfileName, _ = cmd.Flags().GetString("profile")
+	if g.ProfileName == "" {
+		g.ProfileName = g.ProjectConfig.Profile
+	}
+	g.Target, _ = cmd.Flags().GetString("target")
+	if g.Target == "" {
+		g.Target = g.Profiles[g.ProfileName].Target
+	}
 }
 
-func (g *Graph) parseProfiles() {
-	g.Profiles = config.ReadProfiles()
+// parseVars merges the vars from dbt_project.yml with the ones passed on the command line,
+// the latter taking precedence.
+func (g *Graph) parseVars(cmd *cobra.Command) {
+	for name, value := range g.ProjectConfig.Vars {
+		g.Vars[name] = value
+	}
+	vars, _ := cmd.Flags().GetString("vars")
+	for name, value := range config.ReadVars(vars) {
+		g.Vars[name] = value
+	}
 }
 
 func (g *Graph) GetActiveConnection() *config.Connection {
-	profile := g.Profiles[g.ProjectConfig.Profile]
-	target := profile.Target
-	connection := profile.Outputs[target]
-	return &connection
+	connection, err := g.Profiles.Connection(g.ProfileName, g.Target)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return connection
+}
+
+// targetContext describes the active target to templates, without any credentials.
+func (g *Graph) targetContext() map[string]interface{} {
+	target := map[string]interface{}{
+		"name":         g.Target,
+		"profile_name": g.ProfileName,
+	}
+	connection, err := g.Profiles.Connection(g.ProfileName, g.Target)
+	if err != nil {
+		return target
+	}
+	target["type"] = connection.Adapter
+	target["account"] = connection.Account
+	target["user"] = connection.User
+	target["role"] = connection.Role
+	target["database"] = connection.Database
+	target["warehouse"] = connection.Warehouse
+	target["schema"] = connection.Schema
+	target["threads"] = connection.Threads
+	return target
 }
 
 func (g *Graph) discoverResources() {
-	err := filepath.WalkDir("./models",
-		func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return err
-			}
+	propertyFiles := make(map[string]propertyFile)
 
-			fileName := d.Name()
-
-			if strings.HasSuffix(fileName, ".yml") {
-				sourcesConfig := config.ReadSources(path)
-
-				for _, sources := range sourcesConfig.Sources {
-					for _, source := range sources.Tables {
-						if _, seen := g.Sources[sources.Name]; !seen {
-							g.Sources[sources.Name] = make(map[string]Source)
-						}
-						g.Sources[sources.Name][source] = Source{
-							Database: sources.Database,
-							Schema:   sources.Schema,
-							Object:   source,
-						}
-					}
-				}
-			}
+	for _, packageDir := range g.installedPackages() {
+		g.discoverPackage(packageDir, config.ReadConfig(packageDir), propertyFiles)
+	}
+	g.discoverPackage(g.ProjectDir, g.ProjectConfig, propertyFiles)
+
+	// models are only known after walking the whole directory, so attach their properties afterwards
+	paths := make([]string, 0, len(propertyFiles))
+	for path := range propertyFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		file := propertyFiles[path]
+		g.applyModelProperties(path, file.packageName, file.properties.Models)
+		g.applyModelProperties(path, file.packageName, file.properties.Seeds)
+		g.applyModelProperties(path, file.packageName, file.properties.Snapshots)
+	}
+	g.addGenericTests()
+}
 
-			if strings.HasSuffix(fileName, ".sql") {
-				// TODO: parse project config
-				name := fileName[0 : len(fileName)-4]
-				key := fmt.Sprintf("model.%s.%s", g.ProjectConfig.Name, name)
-				content, err := ioutil.ReadFile(path)
+// newNode creates a node of the given resource type in the target database and schema.
+func (g *Graph) newNode(resourceType string, name string, packageName string, packageDir string, path string, rawSql string) *Model {
+	connection, _ := g.Profiles.Connection(g.ProfileName, g.Target)
+	if connection == nil {
+		connection = &config.Connection{}
+	}
+	materialization := map[string]string{"model": "view", "seed": "seed", "snapshot": "snapshot", "test": "test"}[resourceType]
+	return &Model{
+		Name:         name,
+		ResourceType: resourceType,
+		Package:      packageName,
+		RootPath:     packageDir,
+		Path:         path,
+		Database:     connection.Database,
+		Schema:       connection.Schema,
+		UniqueId:     nodeId(resourceType, packageName, name),
+		RawSql:       rawSql,
+		Children:     make(map[string]bool),
+		Parents:      make(map[string]bool),
+		Sources:      make(map[string]bool),
+		Config:       createModelConfig(materialization, ""),
+		Meta:         make(map[string]interface{}),
+		quoting: quoting{
+			database:   g.ProjectConfig.Quoting["database"],
+			schema:     g.ProjectConfig.Quoting["schema"],
+			identifier: g.ProjectConfig.Quoting["identifier"],
+		},
+	}
+}
+
+func nodeId(resourceType string, packageName string, name string) string {
+	return fmt.Sprintf("%s.%s.%s", resourceType, packageName, name)
+}
+
+// addNode adds a node to the graph. Every package has its own namespace, within a package the names of all
+// nodes have to be unique, so that ref('package', 'name') always finds a single node.
+func (g *Graph) addNode(model *Model) {
+	existing := g.packageNode(model.Package, model.Name)
+	if existing == nil {
+		existing = g.Models[model.UniqueId]
+	}
+	if existing != nil {
+		log.Fatalf("Duplicate name detected: %s %s (%s) and %s %s (%s)", existing.ResourceType, existing.Name, existing.Path, model.ResourceType, model.Name, model.Path)
+	}
+	g.Models[model.UniqueId] = model
+}
+
+// packageNode returns the model, seed or snapshot of a package by name, or nil when it doesn't exist.
+func (g *Graph) packageNode(packageName string, name string) *Model {
+	for _, resourceType := range []string{"model", "seed", "snapshot"} {
+		if model, seen := g.Models[nodeId(resourceType, packageName, name)]; seen {
+			return model
+		}
+	}
+	return nil
+}
+
+// installedPackages returns the directories of all packages installed by the deps command.
+func (g *Graph) installedPackages() []string {
+	packageDirs := make([]string, 0)
+	entries, err := ioutil.ReadDir(g.packagesInstallPath())
+	if err != nil {
+		// no packages installed
+		return packageDirs
+	}
+	for _, entry := range entries {
+		packageDir := filepath.Join(g.packagesInstallPath(), entry.Name())
+		if _, err := os.Stat(filepath.Join(packageDir, "dbt_project.yml")); entry.IsDir() && err == nil {
+			packageDirs = append(packageDirs, packageDir)
+		}
+	}
+	return packageDirs
+}
+
+func (g *Graph) packagesInstallPath() string {
+	return filepath.Join(g.ProjectDir, firstNonEmpty(g.ProjectConfig.PackagesInstallPath, g.ProjectConfig.ModulesPath, "dbt_packages"))
+}
+
+// propertyFile is a property file, which describes the nodes of the package it is part of.
+type propertyFile struct {
+	packageName string
+	properties  config.Properties
+}
+
+func (g *Graph) discoverPackage(packageDir string, packageConfig config.Config, propertyFiles map[string]propertyFile) {
+	packageName := packageConfig.Name
+
+	modelPaths := packageConfig.ModelPaths
+	if len(modelPaths) == 0 {
+		modelPaths = packageConfig.SourcePaths
+	}
+	if len(modelPaths) == 0 {
+		modelPaths = []string{"models"}
+	}
+	for _, modelPath := range modelPaths {
+		err := filepath.WalkDir(filepath.Join(packageDir, modelPath),
+			func(path string, d fs.DirEntry, err error) error {
 				if err != nil {
-					log.Fatal(err)
+					return err
 				}
 
-				if _, seen := g.Models[name]; seen {
-					log.Fatal("Duplicate name detected", name)
+				fileName := d.Name()
+
+				if strings.HasSuffix(fileName, ".yml") {
+					properties := config.ReadProperties(path)
+					propertyFiles[path] = propertyFile{packageName: packageName, properties: properties}
+
+					for _, source := range properties.Sources {
+						g.addSource(packageName, packageDir, path, source)
+					}
 				}
 
-				g.Models[name] = &Model{
-					Name:     name,
-					DirEntry: d,
-					UniqueId: key,
-					RawSql:   string(content),
-					Children: make(map[string]bool),
-					Parents:  make(map[string]bool),
-					Config:   createModelConfig("view", ""),
+				if strings.HasSuffix(fileName, ".sql") {
+					content, err := ioutil.ReadFile(path)
+					if err != nil {
+						log.Fatal(err)
+					}
+					model := g.newNode("model", fileName[0:len(fileName)-4], packageName, packageDir, path, string(content))
+					model.DirEntry = d
+					err = g.applyProjectConfig(model, modelPath)
+					if err != nil {
+						log.Fatal(err)
+					}
+					g.addNode(model)
 				}
-			}
 
-			return nil
-		})
-	if err != nil {
-		log.Println(err)
+				return nil
+			})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Println(err)
+		}
+	}
+
+	g.discoverSeeds(packageName, packageDir, packageConfig)
+	g.discoverSnapshots(packageName, packageDir, packageConfig)
+	g.discoverSingularTests(packageName, packageDir, packageConfig)
+
+	macroPaths := packageConfig.MacroPaths
+	if len(macroPaths) == 0 {
+		macroPaths = []string{"macros"}
+	}
+	for _, macroPath := range macroPaths {
+		g.discoverMacros(packageName, packageDir, filepath.Join(packageDir, macroPath))
+	}
+}
+
+func (g *Graph) addSource(packageName string, packageDir string, path string, source config.Source) {
+	connection, _ := g.Profiles.Connection(g.ProfileName, g.Target)
+
+	for _, table := range source.Tables {
+		uniqueId := fmt.Sprintf("source.%s.%s.%s", packageName, source.Name, table.Name)
+		if _, seen := g.Sources[uniqueId]; seen {
+			log.Fatalf("Source table '%s.%s' is defined more than once in package '%s'", source.Name, table.Name, packageName)
+		}
+		// table settings override the source settings, which in turn override the project and profile settings
+		database := firstNonEmpty(table.Database, source.Database)
+		schema := firstNonEmpty(table.Schema, source.Schema, source.Name)
+		if connection != nil {
+			database = firstNonEmpty(database, connection.Database)
+		}
+		freshness := source.Freshness
+		if table.Freshness != nil {
+			freshness = table.Freshness
+		}
+		meta := make(map[string]interface{})
+		for key, value := range source.Meta {
+			meta[key] = value
+		}
+		for key, value := range table.Meta {
+			meta[key] = value
+		}
+
+		g.Sources[uniqueId] = &Source{
+			UniqueId:   uniqueId,
+			SourceName: source.Name,
+			Name:       table.Name,
+			Package:    packageName,
+			RootPath:   packageDir,
+			Path:       path,
+			Database:   database,
+			Schema:     schema,
+			Object:     firstNonEmpty(table.Identifier, table.Name),
+			Quoting: quoting{
+				database:   resolveQuoting(g.ProjectConfig.Quoting["database"], source.Quoting.Database, table.Quoting.Database),
+				schema:     resolveQuoting(g.ProjectConfig.Quoting["schema"], source.Quoting.Schema, table.Quoting.Schema),
+				identifier: resolveQuoting(g.ProjectConfig.Quoting["identifier"], source.Quoting.Identifier, table.Quoting.Identifier),
+			},
+			LoadedAtField: firstNonEmpty(table.LoadedAtField, source.LoadedAtField),
+			Freshness:     freshness,
+			Loader:        source.Loader,
+			Description:   firstNonEmpty(table.Description, source.Description),
+			Meta:          meta,
+			Tags:          append(append([]string{}, source.Tags...), table.Tags...),
+			Columns:       table.Columns,
+			Tests:         table.Tests,
+			Children:      make(map[string]bool),
+		}
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// resolveQuoting returns the most specific quoting setting, starting from the project default.
+func resolveQuoting(project bool, settings ...*bool) bool {
+	quoted := project
+	for _, setting := range settings {
+		if setting != nil {
+			quoted = *setting
+		}
+	}
+	return quoted
+}
+
+func (g *Graph) applyModelProperties(path string, packageName string, models []config.NodeProperties) {
+	for _, properties := range models {
+		model := g.packageNode(packageName, properties.Name)
+		if model == nil {
+			err := g.warn(unusedYaml, fmt.Sprintf("%s describes model '%s' which does not exist", path, properties.Name))
+			if err != nil {
+				log.Fatal(err)
+			}
+			continue
+		}
+		if model.PatchPath != "" {
+			log.Fatalf("Model '%s' is described in both %s and %s", model.Name, model.PatchPath, path)
+		}
+		model.PatchPath = path
+		model.Description = properties.Description
+		model.Columns = properties.Columns
+		model.Constraints = properties.Constraints
+		model.Tags = properties.Tags
+		model.Tests = properties.Tests
+		if properties.Meta != nil {
+			model.Meta = properties.Meta
+		}
+		if properties.Docs != nil {
+			model.Docs = *properties.Docs
+		}
+		for key, value := range properties.Config {
+			err := model.Config.apply(key, value)
+			if err != nil {
+				log.Fatalf("%s: %v", path, err)
+			}
+		}
 	}
 }
 
 func (g *Graph) parseModels() {
-	for name, model := range g.Models {
-		_, err := compileWithContext(model, pongo2.Context{
-			"ref":    g.registerRef(name),
-			"source": g.source,
-			"config": model.Config,
-		})
+	for _, model := range g.Models {
+		context := g.modelContext(model)
+		context["ref"] = g.registerRef(model)
+		context["source"] = g.registerSource(model)
+		context["config"] = registerConfig(model)
+		_, err := g.compileWithContext(model, context)
 		if err != nil {
-			log.Fatal("Could not parse template")
+			log.Fatalf("Could not parse template of %s: %v", model.UniqueId, err)
 		}
 	}
 }
 
-func compileWithContext(model *Model, pongoContext pongo2.Context) (string, error) {
-	tpl, err := pongo2.FromString(model.RawSql)
+// compileModels renders the SQL of all models without executing anything.
+func (g *Graph) compileModels() {
+	for _, model := range g.Models {
+		compiledSql, err := g.compileWithContext(model, g.modelContext(model))
+		if err != nil {
+			log.Fatalf("An error occurred while compiling %s: %v", model.UniqueId, err)
+		}
+		model.CompiledSql = compiledSql
+	}
+}
+
+// modelContext returns the template context shared by the parse and the execution phase. Outside of the
+// execution phase execute is false and run_query and statement blocks do nothing.
+func (g *Graph) modelContext(model *Model) pongo2.Context {
+	return newIntrospection(context.Background(), nil).context(g.withMacros(model.Package, pongo2.Context{
+		"ref":    g.ref(model.Package),
+		"source": g.source(model.Package),
+		"config": func(...interface{}) string { return "" },
+		"var":    g.contextVar(model),
+		"this":   model.fqn(),
+		"target": g.targetContext(),
+	}))
+}
+
+// executionContext is the template context of a model while it runs, where run_query and statement blocks
+// are executed on its connection, e.g. to pivot on the distinct values of a column.
+func (g *Graph) executionContext(ctx context.Context, conn database.Queryer, model *Model) pongo2.Context {
+	return newIntrospection(ctx, conn).context(g.modelContext(model))
+}
+
+func (g *Graph) compileWithContext(model *Model, pongoContext pongo2.Context) (string, error) {
+	tpl, err := pongo2.FromString(g.macroPreamble() + jinjaSubscripts(model.RawSql))
 	if err != nil {
 		return "", err
 	}
@@ -186,34 +594,133 @@ func compileWithContext(model *Model, pongoContext pongo2.Context) (string, erro
 	return compiledSql, nil
 }
 
-func (g *Graph) registerRef(name string) func(string) Relation {
-	return func(ref string) Relation {
-		if _, seen := g.Models[ref]; seen {
-			g.Models[name].Parents[ref] = true
-			g.Models[ref].Children[name] = true
-		} else {
-			log.Fatal("Target ref doesn't exist")
+func (g *Graph) registerRef(model *Model) func(...string) (Relation, error) {
+	return func(names ...string) (Relation, error) {
+		ref, err := g.resolveRef(model.Package, names)
+		if err != nil {
+			return Relation{}, err
+		}
+		model.Parents[ref.UniqueId] = true
+		ref.Children[model.UniqueId] = true
+		return ref.fqn(), nil
+	}
+}
+
+// ref returns the ref() of templates in a package.
+func (g *Graph) ref(packageName string) func(...string) (Relation, error) {
+	return func(names ...string) (Relation, error) {
+		ref, err := g.resolveRef(packageName, names)
+		if err != nil {
+			return Relation{}, err
+		}
+		return ref.fqn(), nil
+	}
+}
+
+// resolveRef finds the node of ref('model') or ref('package', 'model') used in a package. Without a package
+// the root project goes first, followed by the package of the node and finally any other package.
+func (g *Graph) resolveRef(packageName string, names []string) (*Model, error) {
+	if len(names) == 0 || len(names) > 2 {
+		return nil, fmt.Errorf("ref() takes a model name and optionally a package name")
+	}
+	name := names[len(names)-1]
+	if len(names) == 2 {
+		model := g.packageNode(names[0], name)
+		if model == nil {
+			return nil, fmt.Errorf("Target ref '%s' doesn't exist in package '%s'", name, names[0])
+		}
+		return model, nil
+	}
+
+	for _, candidate := range []string{g.ProjectConfig.Name, packageName} {
+		if model := g.packageNode(candidate, name); model != nil {
+			return model, nil
+		}
+	}
+	packages := make([]string, 0)
+	var found *Model
+	for _, model := range g.Models {
+		if model.Name == name && model.ResourceType != "test" {
+			packages = append(packages, model.Package)
+			found = model
+		}
+	}
+	switch len(packages) {
+	case 0:
+		return nil, fmt.Errorf("Target ref '%s' doesn't exist", name)
+	case 1:
+		return found, nil
+	}
+	sort.Strings(packages)
+	return nil, fmt.Errorf("Target ref '%s' is ambiguous, it exists in the packages %s, use ref('<package>', '%s')", name, strings.Join(packages, ", "), name)
+}
+
+func (g *Graph) registerSource(model *Model) func(string, string) (Relation, error) {
+	return func(sourceName string, tableName string) (Relation, error) {
+		source, err := g.resolveSource(model.Package, sourceName, tableName)
+		if err != nil {
+			return Relation{}, err
 		}
+		model.Sources[source.selector()] = true
+		source.Children[model.UniqueId] = true
+		return source.fqn(), nil
+	}
+}
 
-		return g.Models[ref].fqn()
+// source returns the source() of templates in a package.
+func (g *Graph) source(packageName string) func(string, string) (Relation, error) {
+	return func(sourceName string, tableName string) (Relation, error) {
+		source, err := g.resolveSource(packageName, sourceName, tableName)
+		if err != nil {
+			return Relation{}, err
+		}
+		return source.fqn(), nil
 	}
 }
 
-func (g *Graph) ref(ref string) Relation {
-	if _, seen := g.Models[ref]; !seen {
-		log.Fatal("Target ref doesn't exist")
+// resolveSource finds the source table of source('name', 'table') used in a package, looking in the root
+// project first, followed by the package of the node and finally any other package.
+func (g *Graph) resolveSource(packageName string, sourceName string, tableName string) (*Source, error) {
+	for _, candidate := range []string{g.ProjectConfig.Name, packageName} {
+		if source, seen := g.Sources[fmt.Sprintf("source.%s.%s.%s", candidate, sourceName, tableName)]; seen {
+			return source, nil
+		}
+	}
+	packages := make([]string, 0)
+	var found *Source
+	for _, source := range g.Sources {
+		if source.SourceName == sourceName && source.Name == tableName {
+			packages = append(packages, source.Package)
+			found = source
+		}
 	}
-	return g.Models[ref].fqn()
+	switch len(packages) {
+	case 0:
+		return nil, fmt.Errorf("Source '%s.%s' doesn't exist", sourceName, tableName)
+	case 1:
+		return found, nil
+	}
+	sort.Strings(packages)
+	return nil, fmt.Errorf("Source '%s.%s' is ambiguous, it exists in the packages %s", sourceName, tableName, strings.Join(packages, ", "))
 }
 
-func (g *Graph) source(namespace string, object string) Relation {
-	if _, seen := g.Sources[namespace]; !seen {
-		// source doesn't exist! bail out
-		log.Fatal("Source namespace doesn't exist")
+func (g *Graph) contextVar(model *Model) func(string, ...interface{}) (interface{}, error) {
+	return func(name string, defaultValue ...interface{}) (interface{}, error) {
+		if value, seen := g.Vars[name]; seen {
+			return value, nil
+		}
+		if len(defaultValue) > 0 {
+			return defaultValue[0], nil
+		}
+		return nil, fmt.Errorf("Required var '%s' not found in config: vars supplied to %s = %v", name, model.Name, g.Vars)
 	}
-	if _, seen := g.Sources[namespace][object]; !seen {
-		// source doesn't exist! bail out
-		log.Fatal("Source table doesn't exist")
+}
+
+func (g *Graph) sourceBySelector(selector string) *Source {
+	for _, source := range g.Sources {
+		if source.selector() == selector {
+			return source
+		}
 	}
-	return g.Sources[namespace][object].fqn()
+	return nil
 }
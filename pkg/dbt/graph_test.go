@@ -0,0 +1,111 @@
+package dbt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+)
+
+func TestRefResolvesModelsAcrossPackages(t *testing.T) {
+	g := &Graph{Models: make(map[string]*Model), ProjectConfig: config.Config{Name: "shop"}}
+	g.addNode(g.newNode("model", "orders", "shop", "project", "project/models/orders.sql", "select 1"))
+	g.addNode(g.newNode("model", "orders", "stripe", "project/dbt_packages/stripe", "project/dbt_packages/stripe/models/orders.sql", "select 2"))
+	g.addNode(g.newNode("model", "payments", "stripe", "project/dbt_packages/stripe", "project/dbt_packages/stripe/models/payments.sql", "select 3"))
+	g.addNode(g.newNode("model", "payments", "adyen", "project/dbt_packages/adyen", "project/dbt_packages/adyen/models/payments.sql", "select 4"))
+
+	for _, ref := range []struct {
+		packageName string
+		names       []string
+		expected    string
+	}{
+		{"shop", []string{"orders"}, "model.shop.orders"},
+		{"stripe", []string{"orders"}, "model.shop.orders"},
+		{"shop", []string{"stripe", "orders"}, "model.stripe.orders"},
+		{"stripe", []string{"payments"}, "model.stripe.payments"},
+		{"adyen", []string{"payments"}, "model.adyen.payments"},
+	} {
+		model, err := g.resolveRef(ref.packageName, ref.names)
+		if err != nil || model.UniqueId != ref.expected {
+			t.Errorf("ref(%v) in %s: %v %v", ref.names, ref.packageName, model, err)
+		}
+	}
+
+	if _, err := g.resolveRef("shop", []string{"payments"}); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Error(err)
+	}
+	if _, err := g.resolveRef("shop", []string{"shop", "payments"}); err == nil {
+		t.Error("expected ref('shop', 'payments') to fail")
+	}
+}
+
+func TestSourceResolvesSourcesAcrossPackages(t *testing.T) {
+	g := &Graph{Sources: make(map[string]*Source), ProjectConfig: config.Config{Name: "shop"}}
+	raw := config.Source{Name: "raw", Tables: []config.SourceTable{{Name: "orders"}, {Name: "refunds"}}}
+	g.addSource("shop", "project", "project/models/sources.yml", config.Source{Name: "raw", Tables: []config.SourceTable{{Name: "orders"}}})
+	g.addSource("stripe", "project/dbt_packages/stripe", "project/dbt_packages/stripe/models/sources.yml", raw)
+	g.addSource("adyen", "project/dbt_packages/adyen", "project/dbt_packages/adyen/models/sources.yml", raw)
+
+	for _, source := range []struct {
+		packageName string
+		table       string
+		expected    string
+	}{
+		{"shop", "orders", "source.shop.raw.orders"},
+		{"stripe", "orders", "source.shop.raw.orders"},
+		{"stripe", "refunds", "source.stripe.raw.refunds"},
+		{"adyen", "refunds", "source.adyen.raw.refunds"},
+	} {
+		found, err := g.resolveSource(source.packageName, "raw", source.table)
+		if err != nil || found.UniqueId != source.expected {
+			t.Errorf("source('raw', '%s') in %s: %v %v", source.table, source.packageName, found, err)
+		}
+	}
+
+	if _, err := g.resolveSource("shop", "raw", "refunds"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Error(err)
+	}
+	if _, err := g.resolveSource("shop", "raw", "payments"); err == nil {
+		t.Error("expected source('raw', 'payments') to fail")
+	}
+}
+
+func TestMacrosAreNamespacedByPackage(t *testing.T) {
+	g := &Graph{Models: make(map[string]*Model), Macros: make(map[string]*Macro), ProjectConfig: config.Config{Name: "shop"}}
+	macro := func(packageName string, name string, sql string) {
+		g.addMacro(&Macro{UniqueId: "macro." + packageName + "." + name, Name: name, Package: packageName, Sql: sql})
+	}
+	macro("stripe", "cents", `{% macro cents(column) %}{{ column }} / 100{% endmacro %}`)
+	macro("adyen", "cents", `{% macro cents(column) %}{{ column }} / 1000{% endmacro %}`)
+	macro("stripe", "refunds", `{% macro refunds() %}refunds_{{ cents("amount") }}{% endmacro %}`)
+	compile := func(packageName string, sql string) (string, error) {
+		model := g.newNode("model", "payments", packageName, "project", "project/models/payments.sql", sql)
+		return g.compileWithContext(model, g.modelContext(model))
+	}
+
+	for _, template := range []struct {
+		packageName string
+		sql         string
+		expected    string
+	}{
+		{"shop", `select {{ stripe.cents("amount") }}, {{ adyen.cents("amount") }}`, "select amount / 100, amount / 1000"},
+		{"adyen", `select {{ cents("amount") }}`, "select amount / 1000"},
+		{"shop", `select {{ refunds() }}`, "select refunds_amount / 100"},
+	} {
+		compiled, err := compile(template.packageName, template.sql)
+		if err != nil || compiled != template.expected {
+			t.Errorf("%s in %s: %s %v", template.sql, template.packageName, compiled, err)
+		}
+	}
+
+	// an ambiguous name only fails when it is called
+	if _, err := compile("shop", `select {{ cents("amount") }}`); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Error(err)
+	}
+
+	macro("shop", "cents", `{% macro cents(column) %}{{ column }} / 10{% endmacro %}`)
+	g.macroSql = ""
+	if compiled, err := compile("stripe", `select {{ cents("amount") }}`); err != nil || compiled != "select amount / 10" {
+		t.Error(compiled, err)
+	}
+}
@@ -0,0 +1,68 @@
+package dbt
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/flosch/pongo2/v4"
+	"github.com/mdesmet/go-dbt/pkg/config"
+)
+
+// execer is implemented by both *sql.DB and *sql.Conn.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// runHooks renders and executes hooks one by one, stopping at the first failure.
+func (g *Graph) runHooks(ctx context.Context, conn execer, name string, hooks []string, hookContext pongo2.Context) error {
+	for i, hook := range hooks {
+		tpl, err := pongo2.FromString(g.macroPreamble() + jinjaSubscripts(hook))
+		if err != nil {
+			return fmt.Errorf("Could not parse %s hook %d: %v", name, i+1, err)
+		}
+		sql, err := tpl.Execute(hookContext)
+		if err != nil {
+			return fmt.Errorf("Could not render %s hook %d: %v", name, i+1, err)
+		}
+		fmt.Fprintf(config.Stdout, "Running %s hook %d of %d\n", name, i+1, len(hooks))
+		_, err = conn.ExecContext(ctx, sql)
+		if err != nil {
+			return fmt.Errorf("%s hook %d failed: %w", name, i+1, err)
+		}
+	}
+	return nil
+}
+
+// runContext is the template context of the on-run-start and on-run-end hooks.
+func (g *Graph) runContext(results []taskResult) pongo2.Context {
+	schemas := make(map[string]bool)
+	for _, model := range g.Models {
+		schemas[model.Schema] = true
+	}
+	schemaList := make([]string, 0, len(schemas))
+	for schema := range schemas {
+		schemaList = append(schemaList, schema)
+	}
+	sort.Strings(schemaList)
+
+	resultList := make([]map[string]interface{}, 0, len(results))
+	for _, result := range results {
+		resultList = append(resultList, map[string]interface{}{
+			"node": map[string]interface{}{
+				"unique_id": g.Models[result.modelId].UniqueId,
+				"name":      g.Models[result.modelId].Name,
+			},
+			"status":  result.ok.String(),
+			"message": result.desc,
+		})
+	}
+
+	return g.withMacros(g.ProjectConfig.Name, pongo2.Context{
+		"var":     g.contextVar(&Model{Name: "on-run hooks"}),
+		"target":  g.targetContext(),
+		"schemas": schemaList,
+		"results": resultList,
+	})
+}
@@ -0,0 +1,298 @@
+package dbt
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/flosch/pongo2/v4"
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/database"
+)
+
+func init() {
+	pongo2.RegisterTag("call", tagCallParser)
+}
+
+var (
+	templateTagPattern   = regexp.MustCompile(`(?s)\{\{.*?\}\}|\{%.*?%\}`)
+	stringLiteralPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+	subscriptPattern     = regexp.MustCompile(`([\w)\]])\[\s*(?:(\d+)|'(\w+)'|"(\w+)")\s*\]`)
+)
+
+// jinjaSubscripts rewrites the subscripts of Jinja, e.g. results.columns[0].values() or row['name'], to the
+// attribute lookups of pongo2, results.columns.0.values() and row.name. Only the tags of a template are
+// rewritten, leaving string literals alone, so that SQL like arr[0] is kept as it is.
+func jinjaSubscripts(template string) string {
+	return templateTagPattern.ReplaceAllStringFunc(template, func(tag string) string {
+		for {
+			literals := stringLiteralPattern.FindAllStringIndex(tag, -1)
+			rewritten := tag
+			for _, match := range subscriptPattern.FindAllStringSubmatchIndex(tag, -1) {
+				bracket := match[3]
+				if insideLiteral(literals, bracket) {
+					continue
+				}
+				key := ""
+				for group := 2; group <= 4; group++ {
+					if match[2*group] >= 0 {
+						key = tag[match[2*group]:match[2*group+1]]
+					}
+				}
+				rewritten = tag[:bracket] + "." + key + tag[match[1]:]
+				break
+			}
+			if rewritten == tag {
+				return tag
+			}
+			tag = rewritten
+		}
+	})
+}
+
+func insideLiteral(literals [][]int, position int) bool {
+	for _, literal := range literals {
+		if position > literal[0] && position < literal[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// introspection runs the queries of run_query and of statement blocks while a template renders. Without a
+// connection nothing is executed, run_query returns none and execute is false.
+type introspection struct {
+	ctx      context.Context
+	conn     database.Queryer
+	results  map[string]map[string]interface{} // the results of the statement blocks by name
+	returned interface{}                       // the value of the last return() call
+	failed   error                             // the error of the first query that failed
+}
+
+func newIntrospection(ctx context.Context, conn database.Queryer) *introspection {
+	return &introspection{ctx: ctx, conn: conn, results: make(map[string]map[string]interface{})}
+}
+
+// context adds run_query, statement blocks, load_result and return to a template context. True, False and None
+// make the Jinja spelling of e.g. fetch_result=True work.
+func (i *introspection) context(pongoContext pongo2.Context) pongo2.Context {
+	pongoContext["execute"] = i.conn != nil
+	pongoContext["run_query"] = i.runQuery
+	pongoContext["statement"] = i.statement
+	pongoContext["load_result"] = i.loadResult
+	pongoContext["return"] = i.returnValue
+	pongoContext["True"] = true
+	pongoContext["False"] = false
+	pongoContext["None"] = nil
+	return pongoContext
+}
+
+func (i *introspection) runQuery(sql string) (map[string]interface{}, error) {
+	if i.conn == nil {
+		return nil, nil
+	}
+	fmt.Fprintln(config.Stdout, "Going to execute SQL", sql)
+	var names []string
+	records := make([][]interface{}, 0)
+	err := queryWithTimeout(i.ctx, i.conn, func(ctx context.Context) error {
+		rows, err := i.conn.QueryContext(ctx, sql)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		names, err = rows.Columns()
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			record := make([]interface{}, len(names))
+			pointers := make([]interface{}, len(names))
+			for j := range record {
+				pointers[j] = &record[j]
+			}
+			err = rows.Scan(pointers...)
+			if err != nil {
+				return err
+			}
+			for j, value := range record {
+				if bytes, ok := value.([]byte); ok {
+					record[j] = string(bytes)
+				}
+			}
+			records = append(records, record)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		i.fail(err)
+		return nil, fmt.Errorf("run_query failed: %w", err)
+	}
+	return newQueryTable(names, records), nil
+}
+
+// renderError is the error of a template that failed on a query, which unwraps to the error of the query
+// so that timeouts and transient errors are recognized. pongo2 only keeps the message of that error.
+type renderError struct {
+	err   error
+	query error
+}
+
+func (e *renderError) Error() string {
+	return e.err.Error()
+}
+
+func (e *renderError) Unwrap() error {
+	return e.query
+}
+
+func (i *introspection) fail(err error) {
+	if i.failed == nil {
+		i.failed = err
+	}
+}
+
+// templateError is the error of rendering a template with this introspection, it unwraps to the error
+// of the query the template failed on.
+func (i *introspection) templateError(err error) error {
+	if err == nil || i.failed == nil {
+		return err
+	}
+	return &renderError{err: err, query: i.failed}
+}
+
+// newQueryTable is the result of a query, modelled after the agate tables of dbt: column_names, rows and
+// columns, where every column has a name and its values().
+func newQueryTable(names []string, rows [][]interface{}) map[string]interface{} {
+	columns := make([]map[string]interface{}, 0, len(names))
+	for j, name := range names {
+		j := j
+		columns = append(columns, map[string]interface{}{
+			"name": name,
+			"values": func() []interface{} {
+				values := make([]interface{}, 0, len(rows))
+				for _, row := range rows {
+					values = append(values, row[j])
+				}
+				return values
+			},
+		})
+	}
+	return map[string]interface{}{
+		"column_names": names,
+		"columns":      columns,
+		"rows":         rows,
+	}
+}
+
+// statement executes the body of {% call statement(name, fetch_result=True) %}, load_result(name) returns
+// its result.
+func (i *introspection) statement(name string, fetchResult bool, sql string) error {
+	if i.conn == nil {
+		return nil
+	}
+	result := map[string]interface{}{"response": "OK", "data": [][]interface{}{}, "table": nil}
+	if fetchResult {
+		table, err := i.runQuery(sql)
+		if err != nil {
+			return fmt.Errorf("statement '%s': %w", name, err)
+		}
+		result["data"] = table["rows"]
+		result["table"] = table
+	} else {
+		fmt.Fprintln(config.Stdout, "Going to execute SQL", sql)
+		response, err := i.conn.ExecContext(i.ctx, sql)
+		if err != nil {
+			i.fail(err)
+			return fmt.Errorf("statement '%s' failed: %w", name, err)
+		}
+		if affected, err := response.RowsAffected(); err == nil {
+			result["response"] = fmt.Sprintf("%d rows affected", affected)
+		}
+	}
+	i.results[name] = result
+	return nil
+}
+
+func (i *introspection) loadResult(name string) map[string]interface{} {
+	return i.results[name]
+}
+
+func (i *introspection) returnValue(value interface{}) string {
+	i.returned = value
+	return ""
+}
+
+// tagCallNode is {% call statement('name', fetch_result=True) %} sql {% endcall %}, the only kind of call
+// block that is supported.
+type tagCallNode struct {
+	name    pongo2.IEvaluator
+	kwargs  map[string]pongo2.IEvaluator
+	wrapper *pongo2.NodeWrapper
+}
+
+func tagCallParser(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, *pongo2.Error) {
+	node := &tagCallNode{kwargs: make(map[string]pongo2.IEvaluator)}
+	if arguments.Match(pongo2.TokenIdentifier, "statement") == nil || arguments.Match(pongo2.TokenSymbol, "(") == nil {
+		return nil, arguments.Error("Only {% call statement(...) %} blocks are supported.", nil)
+	}
+	name, err := arguments.ParseExpression()
+	if err != nil {
+		return nil, err
+	}
+	node.name = name
+	for arguments.Match(pongo2.TokenSymbol, ",") != nil {
+		key := arguments.MatchType(pongo2.TokenIdentifier)
+		if key == nil || arguments.Match(pongo2.TokenSymbol, "=") == nil {
+			return nil, arguments.Error("Expected a keyword argument, e.g. fetch_result=True.", nil)
+		}
+		if key.Val != "fetch_result" && key.Val != "auto_begin" {
+			return nil, arguments.Error(fmt.Sprintf("Unknown argument '%s' of statement, expected fetch_result or auto_begin.", key.Val), key)
+		}
+		value, err := arguments.ParseExpression()
+		if err != nil {
+			return nil, err
+		}
+		node.kwargs[key.Val] = value
+	}
+	if arguments.Match(pongo2.TokenSymbol, ")") == nil || arguments.Remaining() > 0 {
+		return nil, arguments.Error("Malformed call statement, expected e.g. {% call statement('main', fetch_result=True) %}.", nil)
+	}
+
+	wrapper, endArguments, err := doc.WrapUntilTag("endcall")
+	if err != nil {
+		return nil, err
+	}
+	if endArguments.Remaining() > 0 {
+		return nil, endArguments.Error("endcall takes no arguments.", nil)
+	}
+	node.wrapper = wrapper
+	return node, nil
+}
+
+func (node *tagCallNode) Execute(ctx *pongo2.ExecutionContext, writer pongo2.TemplateWriter) *pongo2.Error {
+	var sql strings.Builder
+	if err := node.wrapper.Execute(ctx, &sql); err != nil {
+		return err
+	}
+	name, err := node.name.Evaluate(ctx)
+	if err != nil {
+		return err
+	}
+	fetchResult := false
+	if value, ok := node.kwargs["fetch_result"]; ok {
+		fetch, err := value.Evaluate(ctx)
+		if err != nil {
+			return err
+		}
+		fetchResult = fetch.IsTrue()
+	}
+	statement, ok := ctx.Public["statement"].(func(string, bool, string) error)
+	if !ok {
+		return ctx.Error("statement blocks are not available here", nil)
+	}
+	if err := statement(name.String(), fetchResult, strings.TrimSpace(sql.String())); err != nil {
+		return ctx.OrigError(err, nil)
+	}
+	return nil
+}
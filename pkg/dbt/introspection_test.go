@@ -0,0 +1,170 @@
+package dbt
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2/v4"
+)
+
+// tableDriver answers every query with the same table, by default two columns of payments, and records the
+// statements. A blocking driver holds every statement until its context is done instead.
+type tableDriver struct {
+	statements []string
+	blocking   bool
+	columns    []string
+	rows       [][]driver.Value
+}
+
+type tableConn struct {
+	driver *tableDriver
+}
+
+type tableRows struct {
+	driver *tableDriver
+	next   int
+}
+
+func (d *tableDriver) Open(string) (driver.Conn, error)             { return tableConn{d}, nil }
+func (d *tableDriver) Connect(context.Context) (driver.Conn, error) { return tableConn{d}, nil }
+func (d *tableDriver) Driver() driver.Driver                        { return d }
+
+func (c tableConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c tableConn) Close() error                        { return nil }
+func (c tableConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c tableConn) QueryContext(ctx context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.driver.statements = append(c.driver.statements, query)
+	if c.driver.blocking {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &tableRows{driver: c.driver}, nil
+}
+
+func (c tableConn) ExecContext(ctx context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.driver.statements = append(c.driver.statements, query)
+	if c.driver.blocking {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return driver.RowsAffected(3), nil
+}
+
+func (r *tableRows) Columns() []string {
+	if r.driver.columns != nil {
+		return r.driver.columns
+	}
+	return []string{"payment_method", "amount"}
+}
+
+func (r *tableRows) Close() error { return nil }
+
+func (r *tableRows) ColumnTypeDatabaseTypeName(i int) string { return []string{"TEXT", "FIXED"}[i] }
+
+func (r *tableRows) Next(dest []driver.Value) error {
+	rows := [][]driver.Value{{"card", int64(10)}, {"cash", int64(5)}}
+	if r.driver.rows != nil {
+		rows = r.driver.rows
+	}
+	if r.next == len(rows) {
+		return io.EOF
+	}
+	copy(dest, rows[r.next])
+	r.next++
+	return nil
+}
+
+func TestRunQueryAndStatementBlocks(t *testing.T) {
+	fake := &tableDriver{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	macro := &Macro{Name: "pivot", Sql: `{% macro pivot(relation, column="payment_method") %}
+{%- set methods = run_query("select distinct "|add:column|add:" from "|add:relation) -%}
+{%- call statement("totals", fetch_result=True) %}select sum(amount) from {{ relation }}{% endcall -%}
+{%- call statement("cleanup") %}delete from {{ relation }} where amount = 0{% endcall -%}
+{%- set totals = load_result("totals") %}{% set cleanup = load_result("cleanup") -%}
+{{ methods.columns.0.values()|join:"," }} {{ totals.table.rows.1.1 }} {{ cleanup.response }}
+{{- return(methods.column_names) }}
+{%- endmacro %}`}
+	call, callContext, err := macroCall(macro, map[string]interface{}{"relation": "payments"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl, err := pongo2.FromString(macro.Sql + call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	introspection := newIntrospection(context.Background(), db)
+	pongoContext := introspection.context(pongo2.Context{})
+	pongoContext.Update(callContext)
+	output, err := tpl.Execute(pongoContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(output) != "card,cash 5 3 rows affected" {
+		t.Error(output)
+	}
+	if len(fake.statements) != 3 || fake.statements[0] != "select distinct payment_method from payments" {
+		t.Error(fake.statements)
+	}
+	if names, ok := introspection.returned.([]string); !ok || strings.Join(names, ",") != "payment_method,amount" {
+		t.Error(introspection.returned)
+	}
+
+	if _, _, err := macroCall(macro, map[string]interface{}{"column": "status"}); err == nil {
+		t.Error("expected a missing argument before a set one to fail")
+	}
+	if _, _, err := macroCall(macro, map[string]interface{}{"typo": 1}); err == nil {
+		t.Error("expected an unknown argument to fail")
+	}
+}
+
+func TestDynamicPivotOnlyQueriesDuringExecution(t *testing.T) {
+	fake := &tableDriver{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	g := &Graph{Models: map[string]*Model{}, Macros: map[string]*Macro{}}
+	model := &Model{Name: "pivoted", Schema: "analytics", Config: createModelConfig("view", ""), RawSql: `{% set methods = run_query("select distinct payment_method from payments") -%}
+select order_id
+{%- if execute %}{% for method in methods.columns[0].values() %}, sum(case when payment_method = '{{ method }}' then amount end) as {{ method }}_amount{% endfor %}{% endif %} from payments`}
+
+	parsed, err := g.compileWithContext(model, g.modelContext(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != "select order_id from payments" || len(fake.statements) != 0 {
+		t.Error(parsed, fake.statements)
+	}
+
+	executed, err := g.compileWithContext(model, g.executionContext(context.Background(), db, model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "select order_id, sum(case when payment_method = 'card' then amount end) as card_amount, sum(case when payment_method = 'cash' then amount end) as cash_amount from payments"
+	if executed != expected || len(fake.statements) != 1 {
+		t.Error(executed, fake.statements)
+	}
+}
+
+func TestJinjaSubscripts(t *testing.T) {
+	for template, expected := range map[string]string{
+		`{{ results.columns[0].values()[1] }}`:  `{{ results.columns.0.values().1 }}`,
+		`{% set name = row['name'] %}`:          `{% set name = row.name %}`,
+		`{{ "a[0]" }} {{ rows[1]["amount"] }}`:  `{{ "a[0]" }} {{ rows.1.amount }}`,
+		`select tags[0] from t {{ x[2] }}`:      `select tags[0] from t {{ x.2 }}`,
+		`{% set values = [1, 2] %}{{ f([3]) }}`: `{% set values = [1, 2] %}{{ f([3]) }}`,
+	} {
+		if rewritten := jinjaSubscripts(template); rewritten != expected {
+			t.Errorf("%s: %s", template, rewritten)
+		}
+	}
+}
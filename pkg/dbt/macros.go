@@ -0,0 +1,191 @@
+package dbt
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/flosch/pongo2/v4"
+)
+
+func init() {
+	pongo2.RegisterTag("bind_macros", tagBindMacrosParser)
+}
+
+type Macro struct {
+	UniqueId string
+	Name     string
+	Package  string
+	RootPath string
+	Path     string
+	Sql      string
+}
+
+var macroPattern = regexp.MustCompile(`(?s)\{%-?\s*macro\s+(\w+)\s*\(.*?\{%-?\s*endmacro\s*-?%\}`)
+
+func (g *Graph) discoverMacros(packageName string, packageDir string, macroDir string) {
+	err := filepath.WalkDir(macroDir,
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !strings.HasSuffix(d.Name(), ".sql") {
+				return nil
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, match := range macroPattern.FindAllStringSubmatch(string(content), -1) {
+				g.addMacro(&Macro{
+					UniqueId: fmt.Sprintf("macro.%s.%s", packageName, match[1]),
+					Name:     match[1],
+					Package:  packageName,
+					RootPath: packageDir,
+					Path:     path,
+					Sql:      match[0],
+				})
+			}
+			return nil
+		})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Println(err)
+	}
+}
+
+// addMacro registers a macro by its unique id.
+func (g *Graph) addMacro(macro *Macro) {
+	if existing, seen := g.Macros[macro.UniqueId]; seen {
+		log.Fatalf("Macro '%s' is defined in both %s and %s", macro.Name, existing.Path, macro.Path)
+	}
+	g.Macros[macro.UniqueId] = macro
+	g.macroSql = ""
+}
+
+// resolveMacro finds the macro a template of a package calls by name. Without a package the root project
+// goes first, followed by the package of the template and finally any other package.
+func (g *Graph) resolveMacro(packageName string, name string) (*Macro, error) {
+	for _, candidate := range []string{g.ProjectConfig.Name, packageName} {
+		if macro, seen := g.Macros[fmt.Sprintf("macro.%s.%s", candidate, name)]; seen {
+			return macro, nil
+		}
+	}
+	packages := make([]string, 0)
+	var found *Macro
+	for _, macro := range g.Macros {
+		if macro.Name == name {
+			packages = append(packages, macro.Package)
+			found = macro
+		}
+	}
+	switch len(packages) {
+	case 0:
+		return nil, fmt.Errorf("Macro '%s' not found", name)
+	case 1:
+		return found, nil
+	}
+	sort.Strings(packages)
+	return nil, fmt.Errorf("Macro '%s' is ambiguous, it exists in the packages %s, use <package>.%s()", name, strings.Join(packages, ", "), name)
+}
+
+// macroIdentifier is the name a macro is defined under in the preamble, which is unique across packages.
+func macroIdentifier(macro *Macro) string {
+	return strings.ReplaceAll(macro.UniqueId, ".", "__")
+}
+
+// macroPreamble returns the definitions of all macros, which get prepended to every template so that
+// the macros can be called from anywhere. They are defined under their macroIdentifier, the bind_macros
+// tag makes them available by name and by package, see withMacros.
+func (g *Graph) macroPreamble() string {
+	if g.macroSql == "" && len(g.Macros) > 0 {
+		ids := make([]string, 0, len(g.Macros))
+		for id := range g.Macros {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		var preamble strings.Builder
+		for _, id := range ids {
+			macro := g.Macros[id]
+			sql := macro.Sql
+			if match := macroPattern.FindStringSubmatchIndex(sql); match != nil {
+				sql = sql[:match[2]] + macroIdentifier(macro) + sql[match[3]:]
+			}
+			preamble.WriteString(jinjaSubscripts(sql))
+		}
+		preamble.WriteString("{% bind_macros %}")
+		g.macroSql = preamble.String()
+	}
+	return g.macroSql
+}
+
+// withMacros adds the macros to the template context of a package. Every package is a namespace, e.g.
+// {{ dbt_utils.star(...) }}, and a macro called by name resolves like resolveMacro, so an ambiguous name
+// only fails when it is called. Within a macro, names resolve relative to the package of the macro.
+func (g *Graph) withMacros(packageName string, pongoContext pongo2.Context) pongo2.Context {
+	namespaces := make(map[string]map[string]interface{})
+	for _, macro := range g.Macros {
+		if _, seen := namespaces[macro.Package]; !seen {
+			namespaces[macro.Package] = make(map[string]interface{})
+			if _, taken := pongoContext[macro.Package]; !taken {
+				pongoContext[macro.Package] = namespaces[macro.Package]
+			}
+		}
+	}
+	callers := []string{packageName} // the package of the template followed by the packages of the macros being called
+	for _, macro := range g.Macros {
+		name := macro.Name
+		if _, taken := pongoContext[name]; taken {
+			continue
+		}
+		pongoContext[name] = func(args ...*pongo2.Value) (*pongo2.Value, error) {
+			resolved, err := g.resolveMacro(callers[len(callers)-1], name)
+			if err != nil {
+				return nil, err
+			}
+			call, ok := namespaces[resolved.Package][name].(func(...*pongo2.Value) *pongo2.Value)
+			if !ok {
+				return nil, fmt.Errorf("Macro '%s' is not defined yet", name)
+			}
+			return call(args...), nil
+		}
+	}
+	// called by the bind_macros tag with the macros the preamble defined
+	pongoContext["bind_macros"] = func(defined pongo2.Context) {
+		for _, macro := range g.Macros {
+			call, ok := defined[macroIdentifier(macro)].(func(...*pongo2.Value) *pongo2.Value)
+			if !ok {
+				continue
+			}
+			macroPackage := macro.Package
+			namespaces[macro.Package][macro.Name] = func(args ...*pongo2.Value) *pongo2.Value {
+				callers = append(callers, macroPackage)
+				defer func() { callers = callers[:len(callers)-1] }()
+				return call(args...)
+			}
+		}
+	}
+	return pongoContext
+}
+
+// tagBindMacrosNode is {% bind_macros %}, which ends the preamble.
+type tagBindMacrosNode struct{}
+
+func tagBindMacrosParser(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, *pongo2.Error) {
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("bind_macros takes no arguments.", nil)
+	}
+	return tagBindMacrosNode{}, nil
+}
+
+func (node tagBindMacrosNode) Execute(ctx *pongo2.ExecutionContext, writer pongo2.TemplateWriter) *pongo2.Error {
+	if bind, ok := ctx.Public["bind_macros"].(func(pongo2.Context)); ok {
+		bind(ctx.Private)
+	}
+	return nil
+}
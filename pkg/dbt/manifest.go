@@ -0,0 +1,272 @@
+package dbt
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+)
+
+type manifestColumn struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	DataType    string                 `json:"data_type,omitempty"`
+	Constraints []manifestConstraint   `json:"constraints,omitempty"`
+	Meta        map[string]interface{} `json:"meta"`
+	Tags        []string               `json:"tags"`
+	Quote       bool                   `json:"quote,omitempty"`
+	Tests       []interface{}          `json:"tests,omitempty"`
+}
+
+type manifestConstraint struct {
+	Type       string   `json:"type"`
+	Name       string   `json:"name,omitempty"`
+	Expression string   `json:"expression,omitempty"`
+	Columns    []string `json:"columns,omitempty"`
+	To         string   `json:"to,omitempty"`
+	ToColumns  []string `json:"to_columns,omitempty"`
+}
+
+type manifestDocs struct {
+	Show      bool   `json:"show"`
+	NodeColor string `json:"node_color,omitempty"`
+}
+
+type manifestDependsOn struct {
+	Nodes []string `json:"nodes"`
+}
+
+type manifestNode struct {
+	UniqueId         string                    `json:"unique_id"`
+	ResourceType     string                    `json:"resource_type"`
+	PackageName      string                    `json:"package_name"`
+	Name             string                    `json:"name"`
+	Alias            string                    `json:"alias"`
+	Database         string                    `json:"database"`
+	Schema           string                    `json:"schema"`
+	Fqn              []string                  `json:"fqn"`
+	Path             string                    `json:"path"`
+	OriginalFilePath string                    `json:"original_file_path"`
+	PatchPath        string                    `json:"patch_path,omitempty"`
+	RawSql           string                    `json:"raw_sql"`
+	CompiledSql      string                    `json:"compiled_sql"`
+	Config           map[string]interface{}    `json:"config"`
+	Description      string                    `json:"description"`
+	Columns          map[string]manifestColumn `json:"columns"`
+	Constraints      []manifestConstraint      `json:"constraints"`
+	Meta             map[string]interface{}    `json:"meta"`
+	Tags             []string                  `json:"tags"`
+	Docs             manifestDocs              `json:"docs"`
+	DependsOn        manifestDependsOn         `json:"depends_on"`
+	RelationName     string                    `json:"relation_name"`
+	Tests            []interface{}             `json:"tests,omitempty"`
+}
+
+type manifestSource struct {
+	UniqueId         string                    `json:"unique_id"`
+	ResourceType     string                    `json:"resource_type"`
+	PackageName      string                    `json:"package_name"`
+	SourceName       string                    `json:"source_name"`
+	Name             string                    `json:"name"`
+	Identifier       string                    `json:"identifier"`
+	Database         string                    `json:"database"`
+	Schema           string                    `json:"schema"`
+	Fqn              []string                  `json:"fqn"`
+	Path             string                    `json:"path"`
+	OriginalFilePath string                    `json:"original_file_path"`
+	Loader           string                    `json:"loader"`
+	LoadedAtField    string                    `json:"loaded_at_field,omitempty"`
+	Freshness        *freshnessCriteria        `json:"freshness,omitempty"`
+	Description      string                    `json:"description"`
+	Columns          map[string]manifestColumn `json:"columns"`
+	Meta             map[string]interface{}    `json:"meta"`
+	Tags             []string                  `json:"tags"`
+	RelationName     string                    `json:"relation_name"`
+	Tests            []interface{}             `json:"tests,omitempty"`
+}
+
+type manifestMacro struct {
+	UniqueId         string `json:"unique_id"`
+	ResourceType     string `json:"resource_type"`
+	PackageName      string `json:"package_name"`
+	Name             string `json:"name"`
+	Path             string `json:"path"`
+	OriginalFilePath string `json:"original_file_path"`
+	MacroSql         string `json:"macro_sql"`
+}
+
+type manifest struct {
+	Metadata  artifactMetadata          `json:"metadata"`
+	Nodes     map[string]manifestNode   `json:"nodes"`
+	Sources   map[string]manifestSource `json:"sources"`
+	Macros    map[string]manifestMacro  `json:"macros"`
+	ParentMap map[string][]string       `json:"parent_map"`
+	ChildMap  map[string][]string       `json:"child_map"`
+}
+
+// writeManifest writes the full graph to target/manifest.json.
+func (g *Graph) writeManifest() string {
+	manifest := manifest{
+		Metadata:  g.artifactMetadata("https://schemas.getdbt.com/dbt/manifest/v4.json"),
+		Nodes:     make(map[string]manifestNode),
+		Sources:   make(map[string]manifestSource),
+		Macros:    make(map[string]manifestMacro),
+		ParentMap: make(map[string][]string),
+		ChildMap:  make(map[string][]string),
+	}
+
+	for _, model := range g.Models {
+		dependsOn := make([]string, 0)
+		for parent := range model.Parents {
+			dependsOn = append(dependsOn, g.Models[parent].UniqueId)
+		}
+		for selector := range model.Sources {
+			dependsOn = append(dependsOn, g.sourceBySelector(selector).UniqueId)
+		}
+		sort.Strings(dependsOn)
+		children := make([]string, 0)
+		for child := range model.Children {
+			children = append(children, g.Models[child].UniqueId)
+		}
+		sort.Strings(children)
+
+		originalFilePath, _ := filepath.Rel(model.RootPath, model.Path)
+		// the path is relative to the model path the model was found in
+		path := originalFilePath[strings.Index(originalFilePath, string(filepath.Separator))+1:]
+		manifest.Nodes[model.UniqueId] = manifestNode{
+			UniqueId:         model.UniqueId,
+			ResourceType:     model.ResourceType,
+			PackageName:      model.Package,
+			Name:             model.Name,
+			Alias:            model.alias(),
+			Database:         model.Database,
+			Schema:           model.Schema,
+			Fqn:              append([]string{model.Package}, strings.Split(strings.TrimSuffix(path, ".sql"), string(filepath.Separator))...),
+			Path:             path,
+			OriginalFilePath: originalFilePath,
+			PatchPath:        model.PatchPath,
+			RawSql:           model.RawSql,
+			CompiledSql:      model.CompiledSql,
+			Config: map[string]interface{}{
+				"materialized": model.Config.Materialization,
+				"alias":        model.Config.Alias,
+				"pre-hook":     nonNilStrings(model.Config.PreHooks),
+				"post-hook":    nonNilStrings(model.Config.PostHooks),
+				"grants":       model.Config.Grants,
+				"copy_grants":  model.Config.CopyGrants,
+				"contract":     map[string]bool{"enforced": model.Config.Contract},
+				"priority":     model.Config.Priority,
+				"retries":      model.Config.Retries,
+				"retry_delay":  model.Config.RetryDelay,
+				"timeout":      model.Config.Timeout,
+				"severity":     firstNonEmpty(model.Config.Severity, "error"),
+				"query_tag":    model.Config.QueryTag,
+			},
+			Description:  model.Description,
+			Columns:      toManifestColumns(model.Columns),
+			Constraints:  toManifestConstraints(model.Constraints),
+			Meta:         model.Meta,
+			Tags:         nonNilStrings(model.Tags),
+			Docs:         manifestDocs{Show: model.Docs.Visible(), NodeColor: model.Docs.NodeColor},
+			DependsOn:    manifestDependsOn{Nodes: dependsOn},
+			RelationName: model.fqn().String(),
+			Tests:        model.Tests,
+		}
+		manifest.ParentMap[model.UniqueId] = dependsOn
+		manifest.ChildMap[model.UniqueId] = children
+	}
+
+	for _, source := range g.Sources {
+		children := make([]string, 0)
+		for child := range source.Children {
+			children = append(children, g.Models[child].UniqueId)
+		}
+		sort.Strings(children)
+
+		originalFilePath, _ := filepath.Rel(source.RootPath, source.Path)
+		var freshness *freshnessCriteria
+		if source.Freshness != nil {
+			freshness = &freshnessCriteria{
+				WarnAfter:  toFreshnessThreshold(source.Freshness.WarnAfter),
+				ErrorAfter: toFreshnessThreshold(source.Freshness.ErrorAfter),
+				Filter:     source.Freshness.Filter,
+			}
+		}
+		manifest.Sources[source.UniqueId] = manifestSource{
+			UniqueId:         source.UniqueId,
+			ResourceType:     "source",
+			PackageName:      source.Package,
+			SourceName:       source.SourceName,
+			Name:             source.Name,
+			Identifier:       source.Object,
+			Database:         source.Database,
+			Schema:           source.Schema,
+			Fqn:              []string{source.Package, source.SourceName, source.Name},
+			Path:             originalFilePath,
+			OriginalFilePath: originalFilePath,
+			Loader:           source.Loader,
+			LoadedAtField:    source.LoadedAtField,
+			Freshness:        freshness,
+			Description:      source.Description,
+			Columns:          toManifestColumns(source.Columns),
+			Meta:             source.Meta,
+			Tags:             nonNilStrings(source.Tags),
+			RelationName:     source.fqn().String(),
+			Tests:            source.Tests,
+		}
+		manifest.ParentMap[source.UniqueId] = []string{}
+		manifest.ChildMap[source.UniqueId] = children
+	}
+
+	for _, macro := range g.Macros {
+		originalFilePath, _ := filepath.Rel(macro.RootPath, macro.Path)
+		manifest.Macros[macro.UniqueId] = manifestMacro{
+			UniqueId:         macro.UniqueId,
+			ResourceType:     "macro",
+			PackageName:      macro.Package,
+			Name:             macro.Name,
+			Path:             originalFilePath,
+			OriginalFilePath: originalFilePath,
+			MacroSql:         macro.Sql,
+		}
+	}
+
+	return g.writeArtifact("manifest.json", manifest)
+}
+
+func toManifestColumns(columns []config.ColumnProperties) map[string]manifestColumn {
+	manifestColumns := make(map[string]manifestColumn)
+	for _, column := range columns {
+		meta := column.Meta
+		if meta == nil {
+			meta = make(map[string]interface{})
+		}
+		manifestColumns[column.Name] = manifestColumn{
+			Name:        column.Name,
+			Description: column.Description,
+			DataType:    column.DataType,
+			Constraints: toManifestConstraints(column.Constraints),
+			Meta:        meta,
+			Tags:        nonNilStrings(column.Tags),
+			Quote:       column.Quote,
+			Tests:       column.Tests,
+		}
+	}
+	return manifestColumns
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func toManifestConstraints(constraints []config.Constraint) []manifestConstraint {
+	manifestConstraints := make([]manifestConstraint, 0, len(constraints))
+	for _, constraint := range constraints {
+		manifestConstraints = append(manifestConstraints, manifestConstraint(constraint))
+	}
+	return manifestConstraints
+}
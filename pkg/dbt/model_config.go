@@ -0,0 +1,226 @@
+package dbt
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// apply sets a single config, as found in dbt_project.yml, a property file or a config() call.
+func (c *ModelConfig) apply(key string, value interface{}) error {
+	switch strings.ReplaceAll(strings.TrimPrefix(key, "+"), "-", "_") {
+	case "materialized":
+		materialization, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("Config 'materialized' should be a string, got %v", value)
+		}
+		c.Materialization = materialization
+	case "alias":
+		alias, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("Config 'alias' should be a string, got %v", value)
+		}
+		c.Alias = alias
+	case "severity":
+		severity, ok := value.(string)
+		severity = strings.ToLower(severity)
+		if !ok || (severity != "error" && severity != "warn") {
+			return fmt.Errorf("Config 'severity' should be error or warn, got %v", value)
+		}
+		c.Severity = severity
+	case "query_tag":
+		tag, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("Config 'query_tag' should be a string, got %v", value)
+		}
+		c.QueryTag = tag
+	case "unique_key", "strategy", "updated_at", "target_schema", "target_database":
+		setting, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("Config '%s' should be a string, got %v", key, value)
+		}
+		switch strings.ReplaceAll(strings.TrimPrefix(key, "+"), "-", "_") {
+		case "unique_key":
+			c.UniqueKey = setting
+		case "strategy":
+			c.Strategy = setting
+		case "updated_at":
+			c.UpdatedAt = setting
+		case "target_schema":
+			c.TargetSchema = setting
+		default:
+			c.TargetDatabase = setting
+		}
+	case "column_types":
+		columnTypes, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("Config 'column_types' should map columns to data types, got %v", value)
+		}
+		c.ColumnTypes = make(map[string]string, len(columnTypes))
+		for column, dataType := range columnTypes {
+			c.ColumnTypes[strings.ToLower(column)] = fmt.Sprint(dataType)
+		}
+	case "pre_hook":
+		hooks, err := toHooks(key, value)
+		if err != nil {
+			return err
+		}
+		c.PreHooks = append(c.PreHooks, hooks...)
+	case "post_hook":
+		hooks, err := toHooks(key, value)
+		if err != nil {
+			return err
+		}
+		c.PostHooks = append(c.PostHooks, hooks...)
+	case "grants":
+		grants, err := toGrants(value)
+		if err != nil {
+			return err
+		}
+		c.Grants = grants
+	case "copy_grants":
+		copyGrants, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("Config 'copy_grants' should be a boolean, got %v", value)
+		}
+		c.CopyGrants = copyGrants
+	case "contract":
+		contract, ok := value.(map[string]interface{})
+		enforced, isBool := contract["enforced"].(bool)
+		if !ok || !isBool {
+			return fmt.Errorf("Config 'contract' should be e.g. {enforced: true}, got %v", value)
+		}
+		c.Contract = enforced
+	case "priority":
+		priority, ok := value.(int)
+		if !ok {
+			return fmt.Errorf("Config 'priority' should be an integer, got %v", value)
+		}
+		c.Priority = priority
+	case "retries", "retry_delay", "timeout":
+		count, ok := value.(int)
+		if !ok || count < 0 {
+			return fmt.Errorf("Config '%s' should be a positive integer, got %v", key, value)
+		}
+		switch {
+		case strings.HasSuffix(key, "retries"):
+			c.Retries = &count
+		case strings.HasSuffix(key, "timeout"):
+			c.Timeout = &count
+		default:
+			c.RetryDelay = &count
+		}
+	}
+	return nil
+}
+
+// isConfigKey tells whether a key in the models section of dbt_project.yml is a config rather than a directory.
+func isConfigKey(key string) bool {
+	if strings.HasPrefix(key, "+") {
+		return true
+	}
+	switch strings.ReplaceAll(key, "-", "_") {
+	case "materialized", "alias", "pre_hook", "post_hook", "grants", "copy_grants", "contract", "priority", "retries", "retry_delay", "timeout",
+		"severity", "unique_key", "strategy", "updated_at", "target_schema", "target_database", "column_types", "query_tag":
+		return true
+	}
+	return false
+}
+
+func toHooks(key string, value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case string:
+		return []string{value}, nil
+	case []interface{}:
+		hooks := make([]string, 0, len(value))
+		for _, hook := range value {
+			sql, ok := hook.(string)
+			if !ok {
+				return nil, fmt.Errorf("Config '%s' should be a list of strings, got %v", key, value)
+			}
+			hooks = append(hooks, sql)
+		}
+		return hooks, nil
+	default:
+		return nil, fmt.Errorf("Config '%s' should be a string or a list of strings, got %v", key, value)
+	}
+}
+
+// toGrants converts e.g. {select: [role_a, role_b]} to the grantees per privilege.
+func toGrants(value interface{}) (map[string][]string, error) {
+	privileges, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Config 'grants' should map privileges to grantees, got %v", value)
+	}
+	grants := make(map[string][]string, len(privileges))
+	for privilege, value := range privileges {
+		grantees, err := toHooks("grants."+privilege, value)
+		if err != nil {
+			return nil, err
+		}
+		for i, grantee := range grantees {
+			grantees[i] = strings.ToLower(grantee)
+		}
+		grants[strings.ToLower(privilege)] = grantees
+	}
+	return grants, nil
+}
+
+// applyProjectConfig applies the configs of the section in dbt_project.yml of the resource type (models,
+// seeds, snapshots or tests), going from the package level down to the directory of the node, so that the
+// most specific config wins.
+func (g *Graph) applyProjectConfig(model *Model, modelPath string) error {
+	relativePath, err := filepath.Rel(filepath.Join(model.RootPath, modelPath), filepath.Dir(model.Path))
+	if err != nil {
+		return err
+	}
+	levels := []string{model.Package}
+	if relativePath != "." {
+		levels = append(levels, strings.Split(relativePath, string(filepath.Separator))...)
+	}
+
+	configs := map[string]map[string]interface{}{
+		"model":    g.ProjectConfig.Models,
+		"seed":     g.ProjectConfig.Seeds,
+		"snapshot": g.ProjectConfig.Snapshots,
+		"test":     g.ProjectConfig.Tests,
+	}[model.ResourceType]
+	for _, level := range levels {
+		next, ok := configs[level].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		configs = next
+		for key, value := range configs {
+			if !isConfigKey(key) {
+				continue
+			}
+			err := model.Config.apply(key, value)
+			if err != nil {
+				return fmt.Errorf("dbt_project.yml: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// registerConfig returns the config() function of the parse phase, which takes key value pairs,
+// e.g. config('materialized', 'table', 'post_hook', 'grant select on {{ this }} to role reporter')
+func registerConfig(model *Model) func(...interface{}) (string, error) {
+	return func(args ...interface{}) (string, error) {
+		if len(args)%2 != 0 {
+			return "", fmt.Errorf("config() takes key value pairs, e.g. config('materialized', 'table')")
+		}
+		for i := 0; i < len(args); i += 2 {
+			key, ok := args[i].(string)
+			if !ok {
+				return "", fmt.Errorf("config() keys should be strings, got %v", args[i])
+			}
+			err := model.Config.apply(key, args[i+1])
+			if err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+	}
+}
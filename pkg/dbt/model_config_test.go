@@ -0,0 +1,61 @@
+package dbt
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+)
+
+func TestApplyProjectConfigFromPackageDownToDirectory(t *testing.T) {
+	g := Graph{ProjectConfig: config.Config{
+		Name: "demo",
+		Models: map[string]interface{}{
+			"demo": map[string]interface{}{
+				"+materialized": "view",
+				"+pre-hook":     "alter session set timezone = 'UTC'",
+				"marts": map[string]interface{}{
+					"materialized": "table",
+					"post-hook":    []interface{}{"grant select on {{ this }} to role reporter"},
+				},
+			},
+		},
+	}}
+	model := &Model{
+		ResourceType: "model",
+		Package:      "demo",
+		RootPath:     "project",
+		Path:         filepath.Join("project", "models", "marts", "orders.sql"),
+		Config:       createModelConfig("view", ""),
+	}
+
+	err := g.applyProjectConfig(model, "models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Config.Materialization != "table" {
+		t.Error(model.Config.Materialization)
+	}
+	if !reflect.DeepEqual(model.Config.PreHooks, []string{"alter session set timezone = 'UTC'"}) {
+		t.Error(model.Config.PreHooks)
+	}
+	if !reflect.DeepEqual(model.Config.PostHooks, []string{"grant select on {{ this }} to role reporter"}) {
+		t.Error(model.Config.PostHooks)
+	}
+}
+
+func TestRegisterConfigTakesKeyValuePairs(t *testing.T) {
+	model := &Model{Config: createModelConfig("view", "")}
+	configure := registerConfig(model)
+
+	if _, err := configure("materialized", "table", "post_hook", "select 1"); err != nil {
+		t.Fatal(err)
+	}
+	if model.Config.Materialization != "table" || !reflect.DeepEqual(model.Config.PostHooks, []string{"select 1"}) {
+		t.Error(model.Config)
+	}
+	if _, err := configure("materialized"); err == nil {
+		t.Error()
+	}
+}
@@ -0,0 +1,92 @@
+package dbt
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/flosch/pongo2/v4"
+	"github.com/mdesmet/go-dbt/pkg/database"
+)
+
+// commentConn adds the query comment of a node to every statement, so that the query history of the
+// warehouse can be attributed to nodes and invocations.
+type commentConn struct {
+	database.Queryer
+	comment string
+	append  bool
+}
+
+func (c commentConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.Queryer.ExecContext(ctx, c.addComment(query), args...)
+}
+
+func (c commentConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.Queryer.QueryContext(ctx, c.addComment(query), args...)
+}
+
+func (c commentConn) addComment(query string) string {
+	if c.comment == "" {
+		return query
+	}
+	if c.append {
+		return fmt.Sprintf("%s\n/* %s */", query, c.comment)
+	}
+	return fmt.Sprintf("/* %s */\n%s", c.comment, query)
+}
+
+// queryComment renders the query-comment of dbt_project.yml for a node, which defaults to a JSON object
+// with the invocation, the node, the target, the user and the git SHA of the project.
+func (g *Graph) queryComment(model *Model) (string, bool, error) {
+	queryComment := g.ProjectConfig.QueryComment
+	if queryComment == nil {
+		comment, err := json.Marshal(map[string]string{
+			"app":           "dbt",
+			"invocation_id": g.InvocationId,
+			"node_id":       model.UniqueId,
+			"target_name":   firstNonEmpty(g.Target, g.Profiles[g.ProfileName].Target),
+			"user":          g.GetActiveConnection().User,
+			"git_sha":       g.gitSha,
+		})
+		return sanitizeComment(string(comment)), false, err
+	}
+	if queryComment.Comment == "" {
+		return "", false, nil
+	}
+
+	tpl, err := pongo2.FromString(g.macroPreamble() + queryComment.Comment)
+	if err != nil {
+		return "", false, err
+	}
+	comment, err := tpl.Execute(g.withMacros(model.Package, pongo2.Context{
+		"invocation_id": g.InvocationId,
+		"node": map[string]interface{}{
+			"unique_id":     model.UniqueId,
+			"name":          model.Name,
+			"resource_type": model.ResourceType,
+			"package_name":  model.Package,
+		},
+		"target":  g.targetContext(),
+		"git_sha": g.gitSha,
+		"var":     g.contextVar(model),
+	}))
+
+	return sanitizeComment(comment), queryComment.Append, err
+}
+
+// sanitizeComment keeps a comment from closing itself early.
+func sanitizeComment(comment string) string {
+	return strings.ReplaceAll(strings.TrimSpace(comment), "*/", "* /")
+}
+
+// gitSha returns the commit checked out in the project directory, or nothing when it isn't a git repository.
+func gitSha(projectDir string) string {
+	out, err := exec.Command("git", "-C", projectDir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
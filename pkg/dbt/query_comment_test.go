@@ -0,0 +1,78 @@
+package dbt
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/database"
+)
+
+// cancellingConn cancels the run after its first statement.
+type cancellingConn struct {
+	database.Queryer
+	cancel context.CancelFunc
+}
+
+func (c cancellingConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer c.cancel()
+	return c.Queryer.ExecContext(ctx, query, args...)
+}
+
+func TestQueryCommentDescribesTheNode(t *testing.T) {
+	g := &Graph{
+		InvocationId: "1234",
+		ProfileName:  "demo",
+		Profiles:     config.Profiles{"demo": {Target: "dev", Outputs: map[string]config.Connection{"dev": {User: "bob"}}}},
+		gitSha:       "abc",
+	}
+	model := &Model{Name: "orders", UniqueId: "model.demo.orders", ResourceType: "model"}
+
+	comment, appendComment, err := g.queryComment(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := map[string]string{}
+	if err := json.Unmarshal([]byte(comment), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed["node_id"] != "model.demo.orders" || parsed["target_name"] != "dev" || parsed["user"] != "bob" || parsed["git_sha"] != "abc" || appendComment {
+		t.Error(comment)
+	}
+
+	g.ProjectConfig.QueryComment = &config.QueryComment{Comment: "run {{ invocation_id }} of {{ node.unique_id }} */", Append: true}
+	comment, appendComment, err = g.queryComment(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement := commentConn{comment: comment, append: appendComment}.addComment("select 1")
+	if statement != "select 1\n/* run 1234 of model.demo.orders * / */" {
+		t.Error(statement)
+	}
+
+	g.ProjectConfig.QueryComment = &config.QueryComment{}
+	if comment, _, _ := g.queryComment(model); comment != "" {
+		t.Error(comment)
+	}
+}
+
+func TestQueryTagIsResetAfterACancelledRun(t *testing.T) {
+	fake := &tableDriver{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	adapter, _ := database.NewAdapter(&config.Connection{Adapter: "snowflake"})
+	g := &Graph{Models: make(map[string]*Model)}
+	model := &Model{Name: "orders", ResourceType: "model", Database: "analytics", Schema: "marts", Config: createModelConfig("table", ""), CompiledSql: "select 1"}
+	model.Config.QueryTag = "orders"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := g.executeModel(ctx, cancellingConn{Queryer: db, cancel: cancel}, adapter, model)
+	if err == nil {
+		t.Fatal("expected the cancelled run to fail the model")
+	}
+	if len(fake.statements) != 2 || fake.statements[1] != "alter session unset query_tag" {
+		t.Error(fake.statements)
+	}
+}
@@ -0,0 +1,241 @@
+package dbt
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+)
+
+var snapshotPattern = regexp.MustCompile(`(?s)\{%-?\s*snapshot\s+(\w+)\s*-?%\}(.*?)\{%-?\s*endsnapshot\s*-?%\}`)
+
+// walkResourcePaths calls fn for every file with the given extension in the resource paths of a package.
+func walkResourcePaths(packageDir string, resourcePaths []string, extension string, fn func(resourcePath string, path string)) {
+	for _, resourcePath := range resourcePaths {
+		err := filepath.WalkDir(filepath.Join(packageDir, resourcePath),
+			func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() && strings.HasSuffix(d.Name(), extension) {
+					fn(resourcePath, path)
+				}
+				return nil
+			})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Println(err)
+		}
+	}
+}
+
+func defaultPaths(paths []string, defaults ...string) []string {
+	if len(paths) == 0 {
+		return defaults
+	}
+	return paths
+}
+
+// discoverSeeds adds every CSV file in the seed paths as a seed.
+func (g *Graph) discoverSeeds(packageName string, packageDir string, packageConfig config.Config) {
+	seedPaths := defaultPaths(packageConfig.SeedPaths, defaultPaths(packageConfig.DataPaths, "seeds")...)
+	walkResourcePaths(packageDir, seedPaths, ".csv", func(seedPath string, path string) {
+		seed := g.newNode("seed", strings.TrimSuffix(filepath.Base(path), ".csv"), packageName, packageDir, path, "")
+		err := g.applyProjectConfig(seed, seedPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		g.addNode(seed)
+	})
+}
+
+// discoverSnapshots adds every {% snapshot name %} ... {% endsnapshot %} block in the snapshot paths.
+func (g *Graph) discoverSnapshots(packageName string, packageDir string, packageConfig config.Config) {
+	walkResourcePaths(packageDir, defaultPaths(packageConfig.SnapshotPaths, "snapshots"), ".sql", func(snapshotPath string, path string) {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, match := range snapshotPattern.FindAllStringSubmatch(string(content), -1) {
+			snapshot := g.newNode("snapshot", match[1], packageName, packageDir, path, match[2])
+			err = g.applyProjectConfig(snapshot, snapshotPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			g.addNode(snapshot)
+		}
+	})
+}
+
+// discoverSingularTests adds every query in the test paths as a test, a test fails when its query returns rows.
+func (g *Graph) discoverSingularTests(packageName string, packageDir string, packageConfig config.Config) {
+	walkResourcePaths(packageDir, defaultPaths(packageConfig.TestPaths, "tests"), ".sql", func(testPath string, path string) {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		test := g.newNode("test", strings.TrimSuffix(filepath.Base(path), ".sql"), packageName, packageDir, path, string(content))
+		err = g.applyProjectConfig(test, testPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		g.addNode(test)
+	})
+}
+
+// genericTest is a test declared in a property file, e.g. unique or {accepted_values: {values: [a, b]}}.
+type genericTest struct {
+	name      string
+	arguments map[string]interface{}
+}
+
+func toGenericTest(test interface{}) (genericTest, error) {
+	switch test := test.(type) {
+	case string:
+		return genericTest{name: test, arguments: map[string]interface{}{}}, nil
+	case map[string]interface{}:
+		if len(test) == 1 {
+			for name, arguments := range test {
+				if arguments == nil {
+					return genericTest{name: name, arguments: map[string]interface{}{}}, nil
+				}
+				if arguments, ok := arguments.(map[string]interface{}); ok {
+					return genericTest{name: name, arguments: arguments}, nil
+				}
+			}
+		}
+	}
+	return genericTest{}, fmt.Errorf("A test should be a name or a name with arguments, e.g. {accepted_values: {values: [a, b]}}, got %v", test)
+}
+
+// addGenericTests turns the tests in the property files of the models, seeds, snapshots and sources into test nodes.
+func (g *Graph) addGenericTests() {
+	ids := make([]string, 0, len(g.Models))
+	for id, model := range g.Models {
+		if model.ResourceType != "test" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		model := g.Models[id]
+		relation := fmt.Sprintf("ref('%s', '%s')", model.Package, model.Name)
+		g.addTests(model.Package, model.RootPath, model.PatchPath, model.UniqueId, model.Name, relation, "", model.Tests)
+		for _, column := range model.Columns {
+			g.addTests(model.Package, model.RootPath, model.PatchPath, model.UniqueId, model.Name, relation, column.Name, column.Tests)
+		}
+	}
+
+	for _, id := range sortedSourceIds(g.Sources) {
+		source := g.Sources[id]
+		prefix := fmt.Sprintf("source_%s_%s", source.SourceName, source.Name)
+		relation := fmt.Sprintf("source('%s', '%s')", source.SourceName, source.Name)
+		g.addTests(source.Package, source.RootPath, source.Path, source.selector(), prefix, relation, "", source.Tests)
+		for _, column := range source.Columns {
+			g.addTests(source.Package, source.RootPath, source.Path, source.selector(), prefix, relation, column.Name, column.Tests)
+		}
+	}
+}
+
+func sortedSourceIds(sources map[string]*Source) []string {
+	ids := make([]string, 0, len(sources))
+	for id := range sources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (g *Graph) addTests(packageName string, packageDir string, path string, testedNode string, prefix string, relation string, column string, tests []interface{}) {
+	for _, declaration := range tests {
+		test, err := toGenericTest(declaration)
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		columnName := column
+		if name, ok := test.arguments["column_name"].(string); ok {
+			columnName = name
+		}
+		sql, err := genericTestSql(test, relation, columnName)
+		if err != nil {
+			log.Fatalf("%s: %s: %v", path, testedNode, err)
+		}
+
+		name := strings.Trim(fmt.Sprintf("%s_%s_%s", test.name, prefix, columnName), "_")
+		for i := 2; g.Models[nodeId("test", packageName, name)] != nil; i++ {
+			name = fmt.Sprintf("%s_%s_%s_%d", test.name, prefix, columnName, i)
+		}
+		node := g.newNode("test", name, packageName, packageDir, path, sql)
+		node.TestedNode = testedNode
+		// the tests section of dbt_project.yml follows the directories of the property file
+		relativePath, _ := filepath.Rel(packageDir, path)
+		err = g.applyProjectConfig(node, strings.SplitN(relativePath, string(filepath.Separator), 2)[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		// the severity can be set as an argument, or in the config of the test
+		configs := map[string]interface{}{}
+		if severity, ok := test.arguments["severity"]; ok {
+			configs["severity"] = severity
+		}
+		if testConfig, ok := test.arguments["config"].(map[string]interface{}); ok {
+			for key, value := range testConfig {
+				configs[key] = value
+			}
+		}
+		for key, value := range configs {
+			err := node.Config.apply(key, value)
+			if err != nil {
+				log.Fatalf("%s: %s: %v", path, name, err)
+			}
+		}
+		g.addNode(node)
+	}
+}
+
+// genericTestSql renders the query of the built-in generic tests, which selects the failing rows.
+func genericTestSql(test genericTest, relation string, column string) (string, error) {
+	if column == "" {
+		return "", fmt.Errorf("Test '%s' needs a column, declare it on a column or set column_name", test.name)
+	}
+	switch test.name {
+	case "not_null":
+		return fmt.Sprintf("select * from {{ %s }} where %s is null", relation, column), nil
+	case "unique":
+		return fmt.Sprintf("select %s as unique_field, count(*) as n_records from {{ %s }} where %s is not null group by %s having count(*) > 1", column, relation, column, column), nil
+	case "accepted_values":
+		values, ok := test.arguments["values"].([]interface{})
+		if !ok || len(values) == 0 {
+			return "", fmt.Errorf("Test 'accepted_values' needs a list of values")
+		}
+		quote := true
+		if setting, ok := test.arguments["quote"].(bool); ok {
+			quote = setting
+		}
+		literals := make([]string, 0, len(values))
+		for _, value := range values {
+			literal := fmt.Sprint(value)
+			if quote {
+				literal = "'" + strings.ReplaceAll(literal, "'", "''") + "'"
+			}
+			literals = append(literals, literal)
+		}
+		return fmt.Sprintf("select * from {{ %s }} where %s not in (%s)", relation, column, strings.Join(literals, ", ")), nil
+	case "relationships":
+		to, _ := test.arguments["to"].(string)
+		field, _ := test.arguments["field"].(string)
+		if !strings.HasPrefix(to, "ref(") && !strings.HasPrefix(to, "source(") || field == "" {
+			return "", fmt.Errorf("Test 'relationships' needs 'to', e.g. ref('customers'), and 'field'")
+		}
+		return fmt.Sprintf("select child.%s from {{ %s }} as child left join {{ %s }} as parent on child.%s = parent.%s where child.%s is not null and parent.%s is null",
+			column, relation, to, column, field, column, field), nil
+	default:
+		return "", fmt.Errorf("Unknown generic test '%s', expected not_null, unique, accepted_values or relationships", test.name)
+	}
+}
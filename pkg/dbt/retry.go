@@ -0,0 +1,47 @@
+package dbt
+
+import (
+	"math/rand"
+	"time"
+)
+
+// maxRetryDelay caps the exponential backoff.
+const maxRetryDelay = 5 * time.Minute
+
+// attempt is a single execution of a model, a model that is retried has several.
+type attempt struct {
+	status   TaskStatus
+	desc     string
+	duration time.Duration
+}
+
+// retryPolicy returns how often a model is retried after a transient error and the delay before the
+// first retry, the model config takes precedence over the profile.
+func (g *Graph) retryPolicy(model *Model) (int, time.Duration) {
+	connection := g.GetActiveConnection()
+	retries := connection.Retries
+	if model.Config.Retries != nil {
+		retries = *model.Config.Retries
+	}
+	delay := connection.RetryDelay
+	if model.Config.RetryDelay != nil {
+		delay = *model.Config.RetryDelay
+	}
+	if delay == 0 {
+		delay = 1
+	}
+	return retries, time.Duration(delay) * time.Second
+}
+
+// retryDelay doubles the delay with every retry and picks a random delay between half and the full
+// backoff, so that threads failing at the same time don't retry at the same time.
+func retryDelay(delay time.Duration, retry int) time.Duration {
+	backoff := delay
+	for i := 1; i < retry && backoff < maxRetryDelay; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryDelay {
+		backoff = maxRetryDelay
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
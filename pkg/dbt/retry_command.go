@@ -0,0 +1,107 @@
+package dbt
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/dag"
+	"github.com/spf13/cobra"
+)
+
+// retryTask re-executes the nodes that didn't succeed in the previous invocation, together with their
+// descendants in the original selection, using the flags of that invocation.
+func retryTask(cmd *cobra.Command, _ []string) {
+	projectDir, _ := cmd.Flags().GetString("project-dir")
+	projectConfig, err := config.LoadConfig(projectDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	previous, err := (&Graph{ProjectDir: projectDir, ProjectConfig: projectConfig}).readRunResults()
+	if err != nil {
+		log.Fatalf("Could not read the results of the previous invocation: %v", err)
+	}
+	which, _ := previous.Args["which"].(string)
+	if which != "run" && which != "build" {
+		log.Fatalf("Can't retry '%s', only run and build can be retried", which)
+	}
+	err = applyPreviousArgs(cmd, previous.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	graph := createGraph(cmd)
+	failed := make(map[string]bool)
+	for _, result := range previous.Results {
+		if result.Status == Ok.String() || result.Status == Warned.String() {
+			continue
+		}
+		if _, seen := graph.Models[result.UniqueId]; seen {
+			failed[result.UniqueId] = true
+		}
+	}
+	if len(failed) == 0 {
+		fmt.Fprintln(config.Stdout, "Nothing to retry, all nodes of the previous invocation succeeded")
+		return
+	}
+
+	fullDag := dag.CreateDag()
+	selection, _ := previous.Args["model"].(string)
+	resourceTypes := []string{"model"}
+	if which == "build" {
+		fullDag = buildDag(graph)
+		selection, _ = previous.Args["select"].(string)
+		resourceTypes = []string{"seed", "model", "snapshot", "test"}
+	} else {
+		populateDag(graph, fullDag)
+	}
+	selected, err := fullDag.ApplySelection(selection)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keepResourceTypes(selected, graph, resourceTypes...)
+	retryDag := retrySelection(selected, failed)
+
+	fmt.Fprintf(config.Stdout, "Retrying %d of the %d nodes of the previous invocation\n", retryDag.Len(), len(previous.Results))
+	failFast, _ := cmd.Flags().GetBool("fail-fast")
+	maxRunDuration, _ := cmd.Flags().GetDuration("max-run-duration")
+	// keep the args of the original invocation, so that a retry can be retried as well
+	runDag(graph, retryDag, failFast, maxRunDuration, previous.Args)
+}
+
+// retrySelection keeps the failed vertices of a selection and their descendants.
+func retrySelection(selected *dag.Dag, failed map[string]bool) *dag.Dag {
+	keep := make(map[string]bool)
+	for vertex := range failed {
+		if !selected.Contains(vertex) {
+			continue
+		}
+		keep[vertex] = true
+		for descendant := range selected.Descendants(vertex) {
+			keep[descendant] = true
+		}
+	}
+	retryDag := selected.Copy()
+	for _, vertex := range retryDag.Vertices() {
+		if !keep[vertex] {
+			retryDag.RemoveVertex(vertex)
+		}
+	}
+	return retryDag
+}
+
+// applyPreviousArgs sets the flags of the previous invocation that weren't set on the command line.
+func applyPreviousArgs(cmd *cobra.Command, args map[string]interface{}) error {
+	for name, value := range args {
+		flag := cmd.Flags().Lookup(strings.ReplaceAll(name, "_", "-"))
+		if flag == nil || flag.Changed {
+			continue
+		}
+		err := flag.Value.Set(fmt.Sprint(value))
+		if err != nil {
+			return fmt.Errorf("Could not restore --%s from the previous invocation: %v", flag.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package dbt
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/mdesmet/go-dbt/pkg/dag"
+	"github.com/spf13/cobra"
+)
+
+func TestRetrySelectionKeepsFailedNodesAndTheirDescendants(t *testing.T) {
+	selected := dag.CreateDag()
+	for _, vertex := range []string{"stg_orders", "stg_customers", "orders", "customers", "report"} {
+		selected.AddVertex(vertex)
+	}
+	selected.AddEdge("stg_orders", "orders")
+	selected.AddEdge("stg_customers", "customers")
+	selected.AddEdge("orders", "report")
+	selected.AddEdge("customers", "report")
+
+	retryDag := retrySelection(selected, map[string]bool{"orders": true, "not_selected": true})
+
+	vertices := retryDag.Vertices()
+	sort.Strings(vertices)
+	if !reflect.DeepEqual(vertices, []string{"orders", "report"}) {
+		t.Error(vertices)
+	}
+	if !reflect.DeepEqual(retryDag.VerticesWithoutAncestors(), []string{"orders"}) {
+		t.Error(retryDag.VerticesWithoutAncestors())
+	}
+}
+
+func TestApplyPreviousArgsKeepsTheFlagsOfTheCommandLine(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("target", "", "")
+	cmd.Flags().BoolP("fail-fast", "x", false, "")
+	cmd.Flags().String("vars", "", "")
+	if err := cmd.Flags().Parse([]string{"--target", "prod"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := applyPreviousArgs(cmd, map[string]interface{}{"which": "run", "target": "dev", "fail_fast": "true", "vars": "{a: 1}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, _ := cmd.Flags().GetString("target")
+	failFast, _ := cmd.Flags().GetBool("fail-fast")
+	vars, _ := cmd.Flags().GetString("vars")
+	if target != "prod" || !failFast || vars != "{a: 1}" {
+		t.Error(target, failFast, vars)
+	}
+}
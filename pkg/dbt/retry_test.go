@@ -0,0 +1,49 @@
+package dbt
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mdesmet/go-dbt/pkg/database"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+func TestRetryDelayBacksOffExponentiallyWithJitter(t *testing.T) {
+	for retry, backoff := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 20: maxRetryDelay} {
+		for i := 0; i < 10; i++ {
+			delay := retryDelay(time.Second, retry)
+			if delay < backoff/2 || delay > backoff {
+				t.Errorf("retry %d: %v not between %v and %v", retry, delay, backoff/2, backoff)
+			}
+		}
+	}
+}
+
+func TestSnowflakeClassifiesTransientErrors(t *testing.T) {
+	adapter := &database.Snowflake{}
+	transient := []error{
+		driver.ErrBadConn,
+		fmt.Errorf("An error occurred while running model m1: %w", &gosnowflake.SnowflakeError{Number: gosnowflake.ErrFailedToPostQuery}),
+		&gosnowflake.SnowflakeError{Number: 1234, SQLState: "08001"},
+	}
+	for _, err := range transient {
+		if !adapter.IsTransient(err) {
+			t.Errorf("expected %v to be transient", err)
+		}
+	}
+	permanent := []error{
+		errors.New("The enforced contract of model m1 failed"),
+		&gosnowflake.SnowflakeError{Number: 2003, SQLState: "42S02", Message: "Object does not exist"},
+		fmt.Errorf("An error occurred while running test t1: %w", context.DeadlineExceeded),
+		fmt.Errorf("An error occurred while running model m1: %w", context.Canceled),
+	}
+	for _, err := range permanent {
+		if adapter.IsTransient(err) {
+			t.Errorf("expected %v to be permanent", err)
+		}
+	}
+}
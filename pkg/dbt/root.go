@@ -2,8 +2,10 @@ package dbt
 
 import "github.com/spf13/cobra"
 
+const version = "0.0.1"
+
 func RootCommand() *cobra.Command {
-	currentVersion := "0.0.1"
+	currentVersion := version
 
 	cmd := cobra.Command{
 		Use:     "fast-dbt",
@@ -16,6 +18,14 @@ Explore the available commands by running 'fast-dbt --help'`,
 
 	cmd.SetVersionTemplate("fast-dbt v{{.Version}}\n")
 
+	cmd.PersistentFlags().String("project-dir", ".", "Which directory to look in for the dbt_project.yml file")
+	cmd.PersistentFlags().String("profiles-dir", "", "Which directory to look in for the profiles.yml file, defaults to DBT_PROFILES_DIR, the project directory or ~/.dbt")
+	cmd.PersistentFlags().String("profile", "", "Which profile to load, overrides the profile in dbt_project.yml")
+	cmd.PersistentFlags().StringP("target", "t", "", "Which target to load for the given profile")
+	cmd.PersistentFlags().String("vars", "", "Supply variables to the project as a YAML or JSON dictionary, e.g. '{my_variable: my_value}'")
+	cmd.PersistentFlags().Bool("warn-error", false, "Treat all warnings as errors")
+	cmd.PersistentFlags().String("warn-error-options", "", "Treat the selected warnings as errors, e.g. '{include: [test-warning, deprecated-config, unused-yaml]}' or '{include: all, exclude: [unused-yaml]}'")
+
 	run := cobra.Command{
 		Use:   "run",
 		Short: "Run a model",
@@ -24,13 +34,52 @@ Explore the available commands by running 'fast-dbt --help'`,
 	}
 
 	run.Flags().StringP("model", "m", "", "Specify the models to be run")
+	run.Flags().BoolP("fail-fast", "x", false, "Stop execution upon a first failure, cancelling the models still running")
+	run.Flags().Duration("max-run-duration", 0, "Cancel the models still running and skip the remaining ones after this duration, e.g. 2h")
 
 	cmd.AddCommand(&run)
 
+	build := cobra.Command{
+		Use:   "build",
+		Short: "Run seeds, models and snapshots and test them in DAG order",
+		Long:  `Runs the selected seeds, models and snapshots and their tests in a single DAG. The tests of a node run right after it, a failing test with severity error skips the nodes downstream.`,
+		Run:   buildTask,
+	}
+
+	build.Flags().StringP("select", "s", "", "Specify the nodes to be built")
+	build.Flags().BoolP("fail-fast", "x", false, "Stop execution upon a first failure, cancelling the nodes still running")
+	build.Flags().Duration("max-run-duration", 0, "Cancel the nodes still running and skip the remaining ones after this duration, e.g. 2h")
+
+	cmd.AddCommand(&build)
+
+	retry := cobra.Command{
+		Use:   "retry",
+		Short: "Re-run the nodes that failed or were skipped in the previous invocation",
+		Long:  `Reads target/run_results.json and runs the nodes that errored, timed out or were skipped, and their descendants, with the selection and flags of the previous invocation.`,
+		Run:   retryTask,
+	}
+
+	retry.Flags().BoolP("fail-fast", "x", false, "Stop execution upon a first failure, cancelling the models still running")
+	retry.Flags().Duration("max-run-duration", 0, "Cancel the models still running and skip the remaining ones after this duration, e.g. 2h")
+
+	cmd.AddCommand(&retry)
+
+	runOperation := cobra.Command{
+		Use:   "run-operation <macro>",
+		Short: "Run a macro",
+		Long:  `Renders a macro with the arguments of --args, executing its run_query calls and statement blocks on the active connection, and prints the value it returns.`,
+		Args:  cobra.ExactArgs(1),
+		Run:   runOperationTask,
+	}
+
+	runOperation.Flags().String("args", "", "Supply arguments to the macro as a YAML or JSON dictionary, e.g. '{days: 7}'")
+
+	cmd.AddCommand(&runOperation)
+
 	compile := cobra.Command{
 		Use:   "compile",
 		Short: "Compile a model",
-		Long:  `TODO`,
+		Long:  `Renders the SQL of every model, checking the enforced contracts against the columns of the compiled SQL in the warehouse.`,
 		Run:   compileTask,
 	}
 
@@ -38,6 +87,18 @@ Explore the available commands by running 'fast-dbt --help'`,
 
 	cmd.AddCommand(&compile)
 
+	grants := cobra.Command{
+		Use:   "grants",
+		Short: "Apply the grants config to the existing relations of the models",
+		Long:  `Compares the grants config of every selected model with SHOW GRANTS on its relation and issues only the GRANT and REVOKE statements needed.`,
+		Run:   grantsTask,
+	}
+
+	grants.Flags().StringP("model", "m", "", "Specify the models to apply the grants of")
+	grants.Flags().Bool("dry-run", false, "Only print the GRANT and REVOKE statements")
+
+	cmd.AddCommand(&grants)
+
 	watch := cobra.Command{
 		Use:   "watch",
 		Short: "Compile all models automatically",
@@ -47,5 +108,69 @@ Explore the available commands by running 'fast-dbt --help'`,
 
 	cmd.AddCommand(&watch)
 
+	deps := cobra.Command{
+		Use:   "deps",
+		Short: "Install the packages listed in packages.yml",
+		Long:  `Installs the local and git packages listed in packages.yml, and their dependencies, into dbt_packages/.`,
+		Run:   depsTask,
+	}
+
+	cmd.AddCommand(&deps)
+
+	source := cobra.Command{
+		Use:   "source",
+		Short: "Manage your project's sources",
+		Long:  `TODO`,
+	}
+
+	freshness := cobra.Command{
+		Use:   "freshness",
+		Short: "Snapshot the freshness of your sources",
+		Long:  `Queries max(loaded_at_field) of every selected source table with a freshness configured and writes the results to target/sources.json.`,
+		Run:   freshnessTask,
+	}
+
+	freshness.Flags().StringP("select", "s", "", "Specify the sources to snapshot, e.g. source:name or source:name.table")
+
+	source.AddCommand(&freshness)
+	cmd.AddCommand(&source)
+
+	docs := cobra.Command{
+		Use:   "docs",
+		Short: "Generate or serve the documentation website for your project",
+		Long:  `TODO`,
+	}
+
+	generate := cobra.Command{
+		Use:   "generate",
+		Short: "Generate the documentation artifacts",
+		Long:  `Writes target/manifest.json and target/catalog.json, the latter by introspecting every model and source in the warehouse unless --no-catalog is set.`,
+		Run:   docsGenerateTask,
+	}
+
+	generate.Flags().Bool("no-catalog", false, "Only write the manifest, without introspecting the warehouse to build catalog.json")
+
+	serve := cobra.Command{
+		Use:   "serve",
+		Short: "Serve the documentation website for your project",
+		Long:  `Hosts the documentation of the artifacts written by 'docs generate' on localhost.`,
+		Run:   docsServeTask,
+	}
+
+	serve.Flags().Int("port", 8080, "Specify the port number for the docs server")
+
+	docs.AddCommand(&generate)
+	docs.AddCommand(&serve)
+	cmd.AddCommand(&docs)
+
+	debug := cobra.Command{
+		Use:   "debug",
+		Short: "Show information on the current dbt environment and check dependencies",
+		Long:  `Validates dbt_project.yml and profiles.yml, checks the private key and tests the connection to the warehouse.`,
+		Run:   debugTask,
+	}
+
+	cmd.AddCommand(&debug)
+
 	return &cmd
 }
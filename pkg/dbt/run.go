@@ -2,21 +2,26 @@ package dbt
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
-	"github.com/flosch/pongo2/v4"
+	"github.com/mdesmet/go-dbt/pkg/config"
 	"github.com/mdesmet/go-dbt/pkg/dag"
 	"github.com/mdesmet/go-dbt/pkg/database"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 type taskResult struct {
-	modelId string
-	ok      TaskStatus
-	desc    string
+	modelId  string
+	ok       TaskStatus
+	desc     string
+	workerId int
+	duration time.Duration
+	attempts []attempt
 }
 
 type TaskStatus int
@@ -25,25 +30,92 @@ const (
 	Ok TaskStatus = iota
 	Error
 	Skipped
+	TimedOut
+	Failed // a test returned rows
+	Warned // a test with severity warn returned rows
 )
 
+func (status TaskStatus) String() string {
+	switch status {
+	case Ok:
+		return "success"
+	case Error:
+		return "error"
+	case TimedOut:
+		return "timeout"
+	case Failed:
+		return "fail"
+	case Warned:
+		return "warn"
+	default:
+		return "skipped"
+	}
+}
+
+// passed tells whether the nodes downstream can run, a test that only warns doesn't stop them.
+func (status TaskStatus) passed() bool {
+	return status == Ok || status == Warned
+}
+
 func runTask(cmd *cobra.Command, _ []string) {
 	dag := dag.CreateDag()
-	graph := createGraph()
+	graph := createGraph(cmd)
 	populateDag(graph, dag)
 
 	// select from dag
 	selection, _ := cmd.Flags().GetString("model")
-	dag, _ = dag.ApplySelection(selection)
+	dag, err := dag.ApplySelection(selection)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keepResourceTypes(dag, graph, "model")
+
+	failFast, _ := cmd.Flags().GetBool("fail-fast")
+	maxRunDuration, _ := cmd.Flags().GetDuration("max-run-duration")
+	runDag(graph, dag, failFast, maxRunDuration, invocationArgs(cmd, "run"))
+}
+
+// runDag runs the models of the dag and writes run_results.json, args are the flags of the invocation.
+func runDag(graph *Graph, dag *dag.Dag, failFast bool, maxRunDuration time.Duration, args map[string]interface{}) []taskResult {
+	ctx := context.Background()
+	if maxRunDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, maxRunDuration)
+		defer cancel()
+	}
 
-	runSelection(graph, dag)
+	start := time.Now()
+	results := runSelection(ctx, graph, dag, failFast)
+	graph.writeRunResults(results, time.Since(start), args)
+	return results
+}
+
+// invocationArgs returns the command and the flags set on the command line, as written to run_results.json.
+func invocationArgs(cmd *cobra.Command, which string) map[string]interface{} {
+	args := map[string]interface{}{"which": which}
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		args[strings.ReplaceAll(flag.Name, "-", "_")] = flag.Value.String()
+	})
+	return args
 }
 
 func populateDag(graph *Graph, dag *dag.Dag) {
 	for _, model := range graph.Models {
-		dag.AddVertex(model.Name)
-		for name := range model.Children {
-			dag.AddEdge(model.Name, name)
+		dag.AddVertex(model.UniqueId)
+		for _, tag := range model.Tags {
+			dag.AddTag(model.UniqueId, tag)
+		}
+		for child := range model.Children {
+			dag.AddEdge(model.UniqueId, child)
+		}
+	}
+	for _, source := range graph.Sources {
+		dag.AddVertex(source.selector())
+		for _, tag := range source.Tags {
+			dag.AddTag(source.selector(), tag)
+		}
+		for name := range source.Children {
+			dag.AddEdge(source.selector(), name)
 		}
 	}
 
@@ -53,84 +125,270 @@ func populateDag(graph *Graph, dag *dag.Dag) {
 	}
 }
 
-func runSelection(graph *Graph, dag *dag.Dag) {
+// runSelection runs the models of the dag, once ctx is done the remaining models are skipped. With
+// failFast the first failure cancels the models still running.
+func runSelection(ctx context.Context, graph *Graph, dag *dag.Dag, failFast bool) []taskResult {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	connection := graph.GetActiveConnection()
 
-	db := database.Connect(connection)
+	adapter, err := database.NewAdapter(connection)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := adapter.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
 	defer db.Close()
 
+	graph.gitSha = gitSha(graph.ProjectDir)
+
+	// every thread gets its own session, the hooks of the run get one more
+	pool := database.NewPool(db, adapter, connection.Threads)
+	defer pool.Close()
+	session, err := pool.Session(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = graph.runHooks(ctx, session, "on-run-start", graph.ProjectConfig.OnRunStart, newIntrospection(ctx, session).context(graph.runContext(nil)))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	numWorkers := connection.Threads
 	numJobs := dag.Len()
 	results := make(chan taskResult, numJobs)
-	jobs := make(chan *Model, numJobs)
+	queue := newScheduler()
+	criticalPaths := dag.CriticalPaths(graph.runtimeEstimates())
 
 	for w := 1; w <= numWorkers; w++ {
-		ctx := context.TODO()
-		conn, err := db.Conn(ctx)
+		workerSession, err := pool.Session(ctx)
 		if err != nil {
 			log.Fatal(err)
 		}
-		go worker(ctx, conn, *graph, w, jobs, results)
+		go worker(ctx, workerSession, adapter, *graph, w, queue, results)
 	}
 
-	// get all nodes without any ancestors and order based on number of descendants
+	// get all nodes without any ancestors, the scheduler orders them by priority and critical path
 	addedModels := make(map[string]bool)
-	addModelsToQueue(addedModels, dag, jobs, graph)
+	addModelsToQueue(addedModels, dag, queue, graph, criticalPaths)
+	if dag.Empty() {
+		queue.close()
+	}
 
+	finished := make([]taskResult, 0, numJobs)
 	for a := 1; a <= numJobs; a++ {
 		result := <-results
-		fmt.Println("Received result", result)
-		dag.RemoveVertex(result.modelId)
-		addModelsToQueue(addedModels, dag, jobs, graph)
-		if result.ok == Error {
-			// skip all descendants if a model errored
+		finished = append(finished, result)
+		fmt.Fprintln(config.Stdout, "Received result", result)
+		if !result.ok.passed() {
+			if failFast && ctx.Err() == nil && result.ok != Skipped {
+				fmt.Fprintf(config.Stdout, "Cancelling all remaining work, %s failed and --fail-fast is set\n", result.modelId)
+				cancel()
+			}
+			// skip all descendants if a node failed, before their other parents make them ready
 			for descendant := range dag.Descendants(result.modelId) {
 				dag.RemoveVertex(descendant)
-				results <- createTaskResult(descendant, Ok, fmt.Sprintf("Skipped Model %s", descendant))
+				results <- createTaskResult(descendant, Skipped, fmt.Sprintf("Skipped %s", descendant))
 			}
-			fmt.Println(result.desc)
 		}
+		if result.ok != Ok {
+			fmt.Fprintln(config.Stdout, result.desc)
+		}
+		dag.RemoveVertex(result.modelId)
+		addModelsToQueue(addedModels, dag, queue, graph, criticalPaths)
 		if dag.Empty() {
-			close(jobs)
+			queue.close()
 		}
 	}
+
+	// on-run-end runs even when the run exceeded its duration
+	if len(graph.ProjectConfig.OnRunEnd) > 0 {
+		err = session.Check(context.Background())
+	}
+	if err == nil {
+		err = graph.runHooks(context.Background(), session, "on-run-end", graph.ProjectConfig.OnRunEnd, newIntrospection(context.Background(), session).context(graph.runContext(finished)))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return finished
 }
 
-func addModelsToQueue(addedModels map[string]bool, dag *dag.Dag, jobs chan<- *Model, graph *Graph) {
+func addModelsToQueue(addedModels map[string]bool, dag *dag.Dag, queue *scheduler, graph *Graph, criticalPaths map[string]float64) {
 	for _, vertex := range dag.VerticesWithoutAncestors() {
 		if _, seen := addedModels[vertex]; !seen {
-			fmt.Println("Adding vertex", vertex)
-			jobs <- graph.Models[vertex]
+			fmt.Fprintln(config.Stdout, "Adding vertex", vertex)
+			queue.push(graph.Models[vertex], criticalPaths[vertex])
 			addedModels[vertex] = true
 		}
 	}
 }
 
-func worker(ctx context.Context, conn *sql.Conn, g Graph, workerId int, jobs <-chan *Model, results chan<- taskResult) {
-	for model := range jobs {
-		runModel(ctx, conn, g, workerId, model, results)
+func worker(ctx context.Context, session *database.Session, adapter database.Adapter, g Graph, workerId int, queue *scheduler, results chan<- taskResult) {
+	for {
+		model, ok := queue.next()
+		if !ok {
+			return
+		}
+		if ctx.Err() != nil {
+			results <- createTaskResult(model.UniqueId, Skipped, fmt.Sprintf("Skipped %s, %s", model.Name, cancellation(ctx)))
+			continue
+		}
+		start := time.Now()
+		result := runModel(ctx, session, adapter, g, workerId, model)
+		result.workerId = workerId
+		result.duration = time.Since(start)
+		results <- result
 	}
 }
 
-func runModel(ctx context.Context, conn *sql.Conn, g Graph, workerId int, model *Model, results chan<- taskResult) {
-	fmt.Println("worker", workerId, "started  job", model.UniqueId)
-	compiledSQl, err := compileWithContext(model, pongo2.Context{
-		"ref":    g.ref,
-		"source": g.source,
-		"config": model.Config,
-	})
+func runModel(ctx context.Context, session *database.Session, adapter database.Adapter, g Graph, workerId int, model *Model) taskResult {
+	fmt.Fprintln(config.Stdout, "worker", workerId, "started  job", model.UniqueId)
+	comment, appendComment, err := g.queryComment(model)
 	if err != nil {
-		log.Fatal("An error occurred while compiling model")
+		return createTaskResult(model.UniqueId, Error, fmt.Sprintf("An error occurred while rendering the query comment of %s %s: %v", model.ResourceType, model.Name, err))
 	}
-	model.CompiledSql = compiledSQl
-	fmt.Println("Going to execute SQL", model.CompiledSql)
-	_, err = conn.ExecContext(ctx, model.CompiledSql)
+	conn := timeoutConn{Queryer: commentConn{Queryer: session, comment: comment, append: appendComment}, timeout: g.queryTimeout(model)}
+	err = session.Check(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return createTaskResult(model.UniqueId, Error, fmt.Sprintf("Could not connect for %s %s: %v", model.ResourceType, model.Name, err))
+	}
+	retries, delay := g.retryPolicy(model)
+	attempts := make([]attempt, 0, 1)
+	for {
+		start := time.Now()
+		// reconnects when the session was dropped, e.g. by the transient error of the previous attempt
+		if len(attempts) > 0 {
+			err = session.Check(ctx)
+		}
+		// the model is compiled on its connection in every attempt, as run_query and statement blocks are
+		// executed while rendering
+		if err == nil {
+			err = g.compileOnConnection(ctx, conn, model)
+		}
+		if err == nil {
+			err = g.executeModel(ctx, conn, adapter, model)
+		}
+		if err == nil {
+			attempts = append(attempts, attempt{Ok, fmt.Sprintf("%s %s has run", strings.Title(model.ResourceType), model.Name), time.Since(start)})
+			break
+		}
+		var failure *testFailure
+		if errors.As(err, &failure) {
+			attempts = append(attempts, attempt{failure.status, failure.message, time.Since(start)})
+			break
+		}
+		if ctx.Err() != nil {
+			attempts = append(attempts, interrupted(ctx, err, time.Since(start)))
+			break
+		}
+		if isTimeout(err) {
+			attempts = append(attempts, attempt{TimedOut, err.Error(), time.Since(start)})
+			break
+		}
+		attempts = append(attempts, attempt{Error, err.Error(), time.Since(start)})
+		if !adapter.IsTransient(err) || len(attempts) > retries {
+			break
+		}
+		wait := retryDelay(delay, len(attempts))
+		fmt.Fprintf(config.Stdout, "%s %s failed with a transient error, retry %d of %d in %v: %v\n", strings.Title(model.ResourceType), model.Name, len(attempts), retries, wait.Round(time.Millisecond), err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			attempts = append(attempts, interrupted(ctx, err, 0))
+			break
+		}
+	}
+
+	fmt.Fprintln(config.Stdout, "worker", workerId, "finished job", model.UniqueId)
+	last := attempts[len(attempts)-1]
+	result := createTaskResult(model.UniqueId, last.status, last.desc)
+	result.attempts = attempts
+	return result
+}
+
+// compileOnConnection sets the compiled SQL of a model, rendered with run_query and statement blocks
+// executing on conn.
+func (g *Graph) compileOnConnection(ctx context.Context, conn database.Queryer, model *Model) error {
+	introspection := newIntrospection(ctx, conn)
+	compiledSql, err := g.compileWithContext(model, introspection.context(g.modelContext(model)))
+	err = introspection.templateError(err)
+	if err != nil {
+		return fmt.Errorf("An error occurred while compiling %s %s: %w", model.ResourceType, model.Name, err)
+	}
+	model.CompiledSql = compiledSql
+	return nil
+}
+
+// executeModel runs the hooks and the statements materializing the model, seed or snapshot, or the
+// query of a test. The hooks run on the same connection, so that they share the session with the node.
+func (g *Graph) executeModel(ctx context.Context, conn database.Queryer, adapter database.Adapter, model *Model) error {
+	if model.Config.QueryTag != "" {
+		_, err := conn.ExecContext(ctx, adapter.QueryTagQuery(model.Config.QueryTag))
+		if err != nil {
+			return fmt.Errorf("Could not set the query tag of %s %s: %w", model.ResourceType, model.Name, err)
+		}
+		// the next node on this session starts with the query tag of the profile again, also when the
+		// run was cancelled or exceeded its duration
+		defer func() {
+			_, err := conn.ExecContext(context.Background(), adapter.QueryTagQuery(""))
+			if err != nil {
+				log.Printf("Warning: could not reset the query tag after %s %s: %v", model.ResourceType, model.Name, err)
+			}
+		}()
+	}
+	if model.ResourceType == "test" {
+		return g.executeTest(ctx, conn, model)
+	}
+	err := g.runHooks(ctx, conn, "pre-hook", model.Config.PreHooks, g.executionContext(ctx, conn, model))
+	if err != nil {
+		return err
+	}
+	if model.Config.Contract {
+		err = checkContract(ctx, conn, adapter, model)
+		if err != nil {
+			return err
+		}
+	}
+	statements, err := g.nodeQueries(adapter, model)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", strings.Title(model.ResourceType), model.Name, err)
+	}
+	for _, statement := range statements {
+		fmt.Fprintln(config.Stdout, "Going to execute SQL", statement)
+		_, err = conn.ExecContext(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("An error occurred while running %s %s: %w", model.ResourceType, model.Name, err)
+		}
+	}
+	err = applyGrants(ctx, conn, adapter, model, false)
+	if err != nil {
+		return err
+	}
+	return g.runHooks(ctx, conn, "post-hook", model.Config.PostHooks, g.executionContext(ctx, conn, model))
+}
+
+// cancellation describes why the context of the run is done.
+func cancellation(ctx context.Context) string {
+	if ctx.Err() == context.DeadlineExceeded {
+		return "the run exceeded --max-run-duration"
+	}
+	return "the run was cancelled by --fail-fast"
+}
+
+// interrupted is the attempt of a model that was cancelled together with the run, which is a
+// timeout when the run exceeded its duration.
+func interrupted(ctx context.Context, err error, duration time.Duration) attempt {
+	if ctx.Err() == context.DeadlineExceeded {
+		return attempt{TimedOut, (&timeoutError{reason: "The run exceeded --max-run-duration", err: err}).Error(), duration}
 	}
-	time.Sleep(time.Second)
-	fmt.Println("worker", workerId, "finished job", model.UniqueId)
-	results <- createTaskResult(model.Name, Ok, fmt.Sprintf("Model %s has run", model.Name))
+	return attempt{Skipped, fmt.Sprintf("Cancelled, %s: %v", cancellation(ctx), err), duration}
 }
 
 func createTaskResult(modelId string, status TaskStatus, desc string) taskResult {
@@ -0,0 +1,113 @@
+package dbt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/flosch/pongo2/v4"
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/mdesmet/go-dbt/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+var macroSignaturePattern = regexp.MustCompile(`(?s)macro\s+\w+\s*\((.*?)\)\s*-?%\}`)
+
+// runOperationTask renders a macro with the arguments of --args, executing its run_query calls and statement
+// blocks on the active connection, e.g. run-operation drop_stale_schemas --args '{days: 7}'
+func runOperationTask(cmd *cobra.Command, args []string) {
+	graph := createGraph(cmd)
+	macro, err := graph.resolveMacro(graph.ProjectConfig.Name, args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	macroArgs, _ := cmd.Flags().GetString("args")
+	call, callContext, err := macroCall(macro, config.ReadVars(macroArgs))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	connection := graph.GetActiveConnection()
+	adapter, err := database.NewAdapter(connection)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := adapter.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	pool := database.NewPool(db, adapter, 1)
+	defer pool.Close()
+	session, err := pool.Session(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	introspection := newIntrospection(context.Background(), session)
+	operationContext := introspection.context(graph.withMacros(graph.ProjectConfig.Name, pongo2.Context{
+		"ref":           graph.ref(graph.ProjectConfig.Name),
+		"source":        graph.source(graph.ProjectConfig.Name),
+		"var":           graph.contextVar(&Model{Name: "operation " + macro.Name}),
+		"target":        graph.targetContext(),
+		"invocation_id": graph.InvocationId,
+	}))
+	operationContext.Update(callContext)
+	tpl, err := pongo2.FromString(graph.macroPreamble() + call)
+	if err != nil {
+		log.Fatal(err)
+	}
+	output, err := tpl.Execute(operationContext)
+	if err != nil {
+		log.Fatalf("Operation %s failed: %v", macro.Name, err)
+	}
+
+	if output = strings.TrimSpace(output); output != "" {
+		fmt.Fprintln(config.Stdout, output)
+	}
+	if introspection.returned != nil {
+		fmt.Fprintf(config.Stdout, "Macro %s returned: %v\n", macro.Name, introspection.returned)
+	}
+}
+
+// macroCall returns the template calling a macro with named arguments, pongo2 only supports positional
+// arguments, so they are passed in the order of the signature of the macro.
+func macroCall(macro *Macro, args map[string]interface{}) (string, pongo2.Context, error) {
+	parameters := make([]string, 0)
+	if match := macroSignaturePattern.FindStringSubmatch(macro.Sql); match != nil && strings.TrimSpace(match[1]) != "" {
+		for _, parameter := range strings.Split(match[1], ",") {
+			parameters = append(parameters, strings.TrimSpace(strings.SplitN(parameter, "=", 2)[0]))
+		}
+	}
+	known := make(map[string]bool, len(parameters))
+	for _, parameter := range parameters {
+		known[parameter] = true
+	}
+	for name := range args {
+		if !known[name] {
+			return "", nil, fmt.Errorf("Macro '%s' has no argument '%s', expected one of: %s", macro.Name, name, strings.Join(parameters, ", "))
+		}
+	}
+
+	// pass the arguments up to the last one that is set, the ones after it take their defaults
+	last := -1
+	for i, parameter := range parameters {
+		if _, set := args[parameter]; set {
+			last = i
+		}
+	}
+	values := make([]string, 0, last+1)
+	callContext := pongo2.Context{}
+	for i, parameter := range parameters[:last+1] {
+		value, set := args[parameter]
+		if !set {
+			return "", nil, fmt.Errorf("Macro '%s' needs argument '%s', as '%s' is set", macro.Name, parameter, parameters[last])
+		}
+		name := fmt.Sprintf("operation_arg_%d", i)
+		callContext[name] = value
+		values = append(values, name)
+	}
+	return fmt.Sprintf("{{ %s(%s) }}", macro.Name, strings.Join(values, ", ")), callContext, nil
+}
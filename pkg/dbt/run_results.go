@@ -0,0 +1,105 @@
+package dbt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+type runAttempt struct {
+	Status        string  `json:"status"`
+	Message       string  `json:"message"`
+	ExecutionTime float64 `json:"execution_time"`
+}
+
+type runResult struct {
+	UniqueId      string       `json:"unique_id"`
+	Status        string       `json:"status"`
+	Message       string       `json:"message"`
+	ThreadId      string       `json:"thread_id"`
+	ExecutionTime float64      `json:"execution_time"`
+	Attempts      []runAttempt `json:"attempts,omitempty"`
+}
+
+type runResultsArtifact struct {
+	Metadata    artifactMetadata       `json:"metadata"`
+	Results     []runResult            `json:"results"`
+	ElapsedTime float64                `json:"elapsed_time"`
+	Args        map[string]interface{} `json:"args"`
+}
+
+// writeRunResults writes target/run_results.json, args holds the command and flags of the invocation.
+func (g *Graph) writeRunResults(results []taskResult, elapsed time.Duration, args map[string]interface{}) string {
+	runResults := make([]runResult, 0, len(results))
+	for _, result := range results {
+		threadId := ""
+		if result.workerId > 0 {
+			threadId = fmt.Sprintf("Thread-%d", result.workerId)
+		}
+		attempts := make([]runAttempt, 0, len(result.attempts))
+		for _, attempt := range result.attempts {
+			attempts = append(attempts, runAttempt{
+				Status:        attempt.status.String(),
+				Message:       attempt.desc,
+				ExecutionTime: attempt.duration.Seconds(),
+			})
+		}
+		runResults = append(runResults, runResult{
+			UniqueId:      g.Models[result.modelId].UniqueId,
+			Status:        result.ok.String(),
+			Message:       result.desc,
+			ThreadId:      threadId,
+			ExecutionTime: result.duration.Seconds(),
+			Attempts:      attempts,
+		})
+	}
+	return g.writeArtifact("run_results.json", runResultsArtifact{
+		Metadata:    g.artifactMetadata("https://schemas.getdbt.com/dbt/run-results/v4.json"),
+		Results:     runResults,
+		ElapsedTime: elapsed.Seconds(),
+		Args:        args,
+	})
+}
+
+// readRunResults reads the run_results.json of the previous invocation.
+func (g *Graph) readRunResults() (runResultsArtifact, error) {
+	artifact := runResultsArtifact{}
+	content, err := ioutil.ReadFile(filepath.Join(g.targetPath(), "run_results.json"))
+	if err != nil {
+		return artifact, err
+	}
+	err = json.Unmarshal(content, &artifact)
+	return artifact, err
+}
+
+// runtimeEstimates returns the expected seconds per model, which is the execution time of the previous
+// run, or the average of all known execution times for models that didn't run before.
+func (g *Graph) runtimeEstimates() func(name string) float64 {
+	runtimes := make(map[string]float64)
+	average := 1.0
+	previous, err := g.readRunResults()
+	if err == nil {
+		total := 0.0
+		for _, result := range previous.Results {
+			if result.Status == Ok.String() {
+				runtimes[result.UniqueId] = result.ExecutionTime
+				total += result.ExecutionTime
+			}
+		}
+		if len(runtimes) > 0 {
+			average = total / float64(len(runtimes))
+		}
+	}
+	return func(name string) float64 {
+		model, ok := g.Models[name]
+		if !ok {
+			return average
+		}
+		if runtime, ok := runtimes[model.UniqueId]; ok {
+			return runtime
+		}
+		return average
+	}
+}
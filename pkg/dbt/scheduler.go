@@ -0,0 +1,81 @@
+package dbt
+
+import (
+	"container/heap"
+	"sync"
+)
+
+type queuedModel struct {
+	model        *Model
+	priority     int     // the priority config of the model, higher runs first
+	criticalPath float64 // the expected seconds from the start of the model until its last descendant finished
+}
+
+// modelQueue implements heap.Interface, popping the model with the highest priority and, for equal
+// priorities, the longest critical path.
+type modelQueue []queuedModel
+
+func (q modelQueue) Len() int { return len(q) }
+
+func (q modelQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	if q[i].criticalPath != q[j].criticalPath {
+		return q[i].criticalPath > q[j].criticalPath
+	}
+	return q[i].model.Name < q[j].model.Name
+}
+
+func (q modelQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *modelQueue) Push(x interface{}) { *q = append(*q, x.(queuedModel)) }
+
+func (q *modelQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// scheduler hands out the models that are ready to run to the workers, most important first.
+type scheduler struct {
+	mu     sync.Mutex
+	ready  *sync.Cond
+	queue  modelQueue
+	closed bool
+}
+
+func newScheduler() *scheduler {
+	s := &scheduler{}
+	s.ready = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *scheduler) push(model *Model, criticalPath float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	heap.Push(&s.queue, queuedModel{model: model, priority: model.Config.Priority, criticalPath: criticalPath})
+	s.ready.Signal()
+}
+
+// next blocks until a model is ready to run, it returns false once the scheduler is closed.
+func (s *scheduler) next() (*Model, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.queue) == 0 && !s.closed {
+		s.ready.Wait()
+	}
+	if len(s.queue) == 0 {
+		return nil, false
+	}
+	return heap.Pop(&s.queue).(queuedModel).model, true
+}
+
+// close wakes up all workers waiting for a model, which stop once the queue is drained.
+func (s *scheduler) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.ready.Broadcast()
+}
@@ -0,0 +1,29 @@
+package dbt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchedulerRunsHighestPriorityThenLongestCriticalPathFirst(t *testing.T) {
+	queue := newScheduler()
+	queue.push(&Model{Name: "short", Config: &ModelConfig{}}, 1)
+	queue.push(&Model{Name: "long", Config: &ModelConfig{}}, 30)
+	queue.push(&Model{Name: "urgent", Config: &ModelConfig{Priority: 10}}, 0.5)
+	queue.push(&Model{Name: "also_short", Config: &ModelConfig{}}, 1)
+	queue.close()
+
+	order := make([]string, 0)
+	for {
+		model, ok := queue.next()
+		if !ok {
+			break
+		}
+		order = append(order, model.Name)
+	}
+
+	expected := []string{"urgent", "long", "also_short", "short"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Error(order)
+	}
+}
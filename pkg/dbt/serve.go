@@ -0,0 +1,45 @@
+package dbt
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/mdesmet/go-dbt/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// The documentation site only uses plain HTML, CSS and JavaScript so that it works offline.
+//
+//go:embed static
+var static embed.FS
+
+func docsServeTask(cmd *cobra.Command, _ []string) {
+	graph := createGraph(cmd)
+	targetPath := graph.targetPath()
+	if _, err := os.Stat(filepath.Join(targetPath, "manifest.json")); err != nil {
+		log.Fatalf("Could not find %s, run 'docs generate' first", filepath.Join(targetPath, "manifest.json"))
+	}
+
+	site, err := fs.Sub(static, "static")
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	for _, artifact := range []string{"manifest.json", "catalog.json"} {
+		path := filepath.Join(targetPath, artifact)
+		mux.HandleFunc("/"+artifact, func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, path)
+		})
+	}
+	mux.Handle("/", http.FileServer(http.FS(site)))
+
+	port, _ := cmd.Flags().GetInt("port")
+	address := fmt.Sprintf("localhost:%d", port)
+	fmt.Fprintf(config.Stdout, "Serving docs at http://%s\n", address)
+	log.Fatal(http.ListenAndServe(address, mux))
+}
@@ -0,0 +1,338 @@
+"use strict";
+
+// All data comes from the artifacts written by `docs generate`, served next to this file.
+const state = {
+  nodes: {},
+  parents: {},
+  children: {},
+  catalog: {},
+  current: null,
+};
+
+async function load() {
+  const manifest = await (await fetch("manifest.json")).json();
+  let catalog = { nodes: {}, sources: {} };
+  try {
+    const response = await fetch("catalog.json");
+    if (response.ok) {
+      catalog = await response.json();
+    }
+  } catch (e) {
+    // the catalog is optional
+  }
+
+  // tests are shown with the nodes they test rather than as nodes of their own
+  const nodes = Object.values(manifest.nodes).filter((node) => node.resource_type !== "test");
+  state.nodes = Object.assign(Object.fromEntries(nodes.map((node) => [node.unique_id, node])), manifest.sources);
+  state.parents = manifest.parent_map;
+  state.children = manifest.child_map;
+  state.catalog = Object.assign({}, catalog.nodes, catalog.sources);
+
+  document.getElementById("search").addEventListener("input", render);
+  document.getElementById("selector").addEventListener("input", render);
+  window.addEventListener("hashchange", () => {
+    state.current = decodeURIComponent(location.hash.replace(/^#!\//, "")) || null;
+    render();
+  });
+
+  state.current = decodeURIComponent(location.hash.replace(/^#!\//, "")) || null;
+  render();
+}
+
+function displayName(node) {
+  return node.resource_type === "source" ? `${node.source_name}.${node.name}` : node.name;
+}
+
+function walk(start, edges) {
+  const seen = new Set();
+  const queue = [start];
+  while (queue.length > 0) {
+    for (const next of edges[queue.shift()] || []) {
+      if (!seen.has(next)) {
+        seen.add(next);
+        queue.push(next);
+      }
+    }
+  }
+  return seen;
+}
+
+// Mirrors the selection syntax of ApplySelection in the dag package: name, source:[package.]name[.table] and tag:name,
+// optionally with + for ancestors and/or descendants.
+function applySelector(selection) {
+  const selected = new Set();
+  for (const selector of selection.split(/\s+/).filter((s) => s !== "")) {
+    const withAncestors = selector.startsWith("+");
+    const withDescendants = selector.length > 1 && selector.endsWith("+");
+    const pattern = selector.replace(/^\+/, "").replace(/\+$/, "");
+
+    const matches = Object.values(state.nodes).filter((node) => {
+      if (pattern.startsWith("source:")) {
+        const name = pattern.substring("source:".length);
+        const names = [node.source_name, `${node.source_name}.${node.name}`];
+        return node.resource_type === "source" && names.concat(names.map((n) => `${node.package_name}.${n}`)).includes(name);
+      }
+      if (pattern.startsWith("tag:")) {
+        return (node.tags || []).includes(pattern.substring("tag:".length));
+      }
+      // a unique id or its trailing dotted parts, e.g. orders or shop.orders for model.shop.orders
+      return node.resource_type !== "source" && (node.unique_id === pattern || node.unique_id.endsWith(`.${pattern}`));
+    });
+    if (matches.length === 0) {
+      throw new Error(`The selector '${selector}' does not match any nodes`);
+    }
+
+    for (const node of matches) {
+      selected.add(node.unique_id);
+      if (withAncestors) {
+        walk(node.unique_id, state.parents).forEach((id) => selected.add(id));
+      }
+      if (withDescendants) {
+        walk(node.unique_id, state.children).forEach((id) => selected.add(id));
+      }
+    }
+  }
+  return selected;
+}
+
+function selection() {
+  const errorElement = document.getElementById("selector-error");
+  errorElement.textContent = "";
+  const selector = document.getElementById("selector").value.trim();
+  if (selector !== "") {
+    try {
+      return applySelector(selector);
+    } catch (e) {
+      errorElement.textContent = e.message;
+    }
+  }
+  return null;
+}
+
+function render() {
+  const selected = selection();
+  renderNavigation(selected);
+
+  let lineage = selected;
+  if (lineage === null && state.current !== null) {
+    lineage = new Set([state.current]);
+    walk(state.current, state.parents).forEach((id) => lineage.add(id));
+    walk(state.current, state.children).forEach((id) => lineage.add(id));
+  }
+  renderGraph(lineage || new Set(Object.keys(state.nodes)));
+  renderDetails();
+}
+
+function renderNavigation(selected) {
+  const search = document.getElementById("search").value.trim().toLowerCase();
+  const groups = { source: [], seed: [], model: [], snapshot: [] };
+  for (const node of Object.values(state.nodes)) {
+    if (selected !== null && !selected.has(node.unique_id)) {
+      continue;
+    }
+    const text = `${displayName(node)} ${node.description || ""}`.toLowerCase();
+    if (search !== "" && !text.includes(search)) {
+      continue;
+    }
+    if (node.docs && node.docs.show === false) {
+      continue;
+    }
+    (groups[node.resource_type] || groups.model).push(node);
+  }
+
+  const nav = document.getElementById("nodes");
+  nav.innerHTML = "";
+  for (const [type, nodes] of Object.entries(groups)) {
+    const title = document.createElement("h3");
+    title.textContent = `${type}s (${nodes.length})`;
+    nav.appendChild(title);
+    nodes.sort((a, b) => displayName(a).localeCompare(displayName(b)));
+    for (const node of nodes) {
+      const link = document.createElement("a");
+      link.href = `#!/${encodeURIComponent(node.unique_id)}`;
+      link.textContent = displayName(node);
+      link.title = node.description || "";
+      if (node.unique_id === state.current) {
+        link.className = "active";
+      }
+      nav.appendChild(link);
+    }
+  }
+}
+
+// Lays out the nodes in columns by their longest distance to a root, then draws the edges between them.
+function renderGraph(ids) {
+  const depth = {};
+  const depthOf = (id) => {
+    if (depth[id] === undefined) {
+      depth[id] = 0;
+      for (const parent of state.parents[id] || []) {
+        if (ids.has(parent)) {
+          depth[id] = Math.max(depth[id], depthOf(parent) + 1);
+        }
+      }
+    }
+    return depth[id];
+  };
+
+  const columns = [];
+  for (const id of ids) {
+    if (!state.nodes[id]) {
+      continue;
+    }
+    const column = depthOf(id);
+    (columns[column] = columns[column] || []).push(id);
+  }
+
+  const width = 180;
+  const height = 28;
+  const position = {};
+  let rows = 0;
+  columns.forEach((column, x) => {
+    column.sort();
+    column.forEach((id, y) => {
+      position[id] = { x: 20 + x * (width + 60), y: 20 + y * (height + 16) };
+    });
+    rows = Math.max(rows, column.length);
+  });
+
+  const ns = "http://www.w3.org/2000/svg";
+  const svg = document.createElementNS(ns, "svg");
+  svg.setAttribute("width", 40 + columns.length * (width + 60));
+  svg.setAttribute("height", 40 + rows * (height + 16));
+
+  for (const id of Object.keys(position)) {
+    for (const child of state.children[id] || []) {
+      if (!position[child]) {
+        continue;
+      }
+      const from = position[id];
+      const to = position[child];
+      const path = document.createElementNS(ns, "path");
+      const startX = from.x + width;
+      const startY = from.y + height / 2;
+      const endX = to.x;
+      const endY = to.y + height / 2;
+      path.setAttribute("d", `M${startX},${startY} C${startX + 30},${startY} ${endX - 30},${endY} ${endX},${endY}`);
+      svg.appendChild(path);
+    }
+  }
+
+  for (const [id, { x, y }] of Object.entries(position)) {
+    const node = state.nodes[id];
+    const group = document.createElementNS(ns, "g");
+    group.setAttribute("class", `node ${node.resource_type}${id === state.current ? " active" : ""}`);
+    group.setAttribute("transform", `translate(${x},${y})`);
+    group.addEventListener("click", () => {
+      location.hash = `#!/${encodeURIComponent(id)}`;
+    });
+
+    const rect = document.createElementNS(ns, "rect");
+    rect.setAttribute("width", width);
+    rect.setAttribute("height", height);
+    const text = document.createElementNS(ns, "text");
+    text.setAttribute("x", 8);
+    text.setAttribute("y", height / 2 + 4);
+    text.textContent = displayName(node).substring(0, 24);
+    const title = document.createElementNS(ns, "title");
+    title.textContent = id;
+
+    group.append(rect, text, title);
+    svg.appendChild(group);
+  }
+
+  const graph = document.getElementById("graph");
+  graph.innerHTML = "";
+  graph.appendChild(svg);
+}
+
+function element(tag, text, className) {
+  const e = document.createElement(tag);
+  if (text !== undefined) {
+    e.textContent = text;
+  }
+  if (className) {
+    e.className = className;
+  }
+  return e;
+}
+
+function describeTest(test) {
+  return typeof test === "string" ? test : Object.keys(test).join(", ");
+}
+
+function renderDetails() {
+  const details = document.getElementById("details");
+  details.innerHTML = "";
+  const node = state.nodes[state.current];
+  if (!node) {
+    details.appendChild(element("p", "Select a model or source to see its documentation."));
+    return;
+  }
+
+  details.appendChild(element("h2", `${displayName(node)} (${node.resource_type})`));
+  details.appendChild(element("p", node.relation_name));
+  for (const tag of node.tags || []) {
+    details.appendChild(element("span", tag, "tag"));
+  }
+  details.appendChild(element("p", node.description || "This node is not documented."));
+
+  const catalog = state.catalog[node.unique_id] || { columns: {}, stats: {} };
+  for (const stat of Object.values(catalog.stats || {})) {
+    if (stat.include) {
+      details.appendChild(element("p", `${stat.label}: ${stat.value}`));
+    }
+  }
+
+  details.appendChild(element("h3", "Columns"));
+  const table = element("table");
+  const header = element("tr");
+  ["Column", "Type", "Description", "Tests"].forEach((title) => header.appendChild(element("th", title)));
+  table.appendChild(header);
+  const columns = Object.assign({}, node.columns);
+  for (const column of Object.values(catalog.columns || {})) {
+    const documented = Object.keys(columns).find((name) => name.toLowerCase() === column.name.toLowerCase());
+    if (documented === undefined) {
+      columns[column.name] = { name: column.name };
+    }
+  }
+  for (const column of Object.values(columns)) {
+    const catalogColumn = Object.values(catalog.columns || {}).find((c) => c.name.toLowerCase() === column.name.toLowerCase());
+    const row = element("tr");
+    row.appendChild(element("td", column.name));
+    row.appendChild(element("td", column.data_type || (catalogColumn && catalogColumn.type) || ""));
+    row.appendChild(element("td", column.description || (catalogColumn && catalogColumn.comment) || ""));
+    row.appendChild(element("td", (column.tests || []).map(describeTest).join(", ")));
+    table.appendChild(row);
+  }
+  details.appendChild(table);
+
+  if ((node.tests || []).length > 0) {
+    details.appendChild(element("h3", "Tests"));
+    details.appendChild(element("p", node.tests.map(describeTest).join(", ")));
+  }
+
+  const dependsOn = state.parents[node.unique_id] || [];
+  const referencedBy = state.children[node.unique_id] || [];
+  for (const [title, ids] of [["Depends on", dependsOn], ["Referenced by", referencedBy]]) {
+    if (ids.length === 0) {
+      continue;
+    }
+    details.appendChild(element("h3", title));
+    for (const id of ids) {
+      const link = element("a", state.nodes[id] ? displayName(state.nodes[id]) : id);
+      link.href = `#!/${encodeURIComponent(id)}`;
+      details.appendChild(link);
+      details.appendChild(element("br"));
+    }
+  }
+
+  if (node.raw_sql !== undefined) {
+    details.appendChild(element("h3", "Source"));
+    details.appendChild(element("pre", node.raw_sql));
+    details.appendChild(element("h3", "Compiled"));
+    details.appendChild(element("pre", node.compiled_sql));
+  }
+}
+
+load();
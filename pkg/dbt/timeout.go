@@ -0,0 +1,76 @@
+package dbt
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mdesmet/go-dbt/pkg/database"
+)
+
+// timeoutError is returned when a statement exceeded its query timeout or the run its --max-run-duration.
+type timeoutError struct {
+	reason string
+	err    error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s: %v", e.reason, e.err)
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
+}
+
+func isTimeout(err error) bool {
+	var timeout *timeoutError
+	return errors.As(err, &timeout)
+}
+
+// timeoutConn executes every statement with a deadline of the query timeout. Queries get their deadline
+// from queryWithTimeout, as it has to last until their rows are read.
+type timeoutConn struct {
+	database.Queryer
+	timeout time.Duration
+}
+
+func (c timeoutConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if c.timeout <= 0 {
+		return c.Queryer.ExecContext(ctx, query, args...)
+	}
+	statementCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	result, err := c.Queryer.ExecContext(statementCtx, query, args...)
+	return result, c.timedOut(ctx, statementCtx, err)
+}
+
+// queryWithTimeout runs a query and reads its rows within the query timeout of conn, when it has one.
+func queryWithTimeout(ctx context.Context, conn database.Queryer, query func(ctx context.Context) error) error {
+	c, ok := conn.(timeoutConn)
+	if !ok || c.timeout <= 0 {
+		return query(ctx)
+	}
+	queryCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.timedOut(ctx, queryCtx, query(queryCtx))
+}
+
+// timedOut marks the error of a statement that exceeded the query timeout, rather than the run being done.
+func (c timeoutConn) timedOut(ctx context.Context, statementCtx context.Context, err error) error {
+	if err != nil && ctx.Err() == nil && statementCtx.Err() == context.DeadlineExceeded {
+		return &timeoutError{reason: fmt.Sprintf("The statement exceeded its timeout of %v", c.timeout), err: err}
+	}
+	return err
+}
+
+// queryTimeout returns the timeout of the statements of a model, the model config takes precedence
+// over the query_timeout of the profile. Zero means no timeout.
+func (g *Graph) queryTimeout(model *Model) time.Duration {
+	timeout := g.GetActiveConnection().QueryTimeout
+	if model.Config.Timeout != nil {
+		timeout = *model.Config.Timeout
+	}
+	return time.Duration(timeout) * time.Second
+}
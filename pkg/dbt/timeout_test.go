@@ -0,0 +1,84 @@
+package dbt
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// slowConn blocks every statement until its context is done.
+type slowConn struct{}
+
+func (slowConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (slowConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestTimeoutConnMarksStatementsExceedingTheQueryTimeout(t *testing.T) {
+	conn := timeoutConn{Queryer: slowConn{}, timeout: 10 * time.Millisecond}
+
+	_, err := conn.ExecContext(context.Background(), "select system$wait(1, 'HOURS')")
+	if !isTimeout(err) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	err = queryWithTimeout(context.Background(), conn, func(ctx context.Context) error {
+		_, err := conn.QueryContext(ctx, "select system$wait(1, 'HOURS')")
+		return err
+	})
+	if !isTimeout(err) {
+		t.Errorf("expected a timeout of the query, got %v", err)
+	}
+
+	// a cancelled run isn't a timeout of the statement
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = conn.ExecContext(ctx, "select 1")
+	if err == nil || isTimeout(err) {
+		t.Errorf("expected the cancellation of the run, got %v", err)
+	}
+	err = queryWithTimeout(ctx, conn, func(ctx context.Context) error {
+		_, err := conn.QueryContext(ctx, "select 1")
+		return err
+	})
+	if err == nil || isTimeout(err) {
+		t.Errorf("expected the cancellation of the run, got %v", err)
+	}
+}
+
+func TestQueryWithTimeoutKeepsTheRowsReadableAndMarksTimeoutsWhileReading(t *testing.T) {
+	db := sql.OpenDB(&tableDriver{})
+	defer db.Close()
+	conn := timeoutConn{Queryer: db, timeout: time.Minute}
+
+	count := 0
+	err := queryWithTimeout(context.Background(), conn, func(ctx context.Context) error {
+		rows, err := conn.QueryContext(ctx, "select * from payments")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			count++
+		}
+		return rows.Err()
+	})
+	if err != nil || count != 2 {
+		t.Error(count, err)
+	}
+
+	// a deadline passing while the rows are read is a timeout as well
+	conn.timeout = 10 * time.Millisecond
+	err = queryWithTimeout(context.Background(), conn, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !isTimeout(err) {
+		t.Errorf("expected a timeout while reading the rows, got %v", err)
+	}
+}
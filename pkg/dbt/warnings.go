@@ -0,0 +1,110 @@
+package dbt
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// The kinds of warnings that --warn-error-options can promote to errors.
+const (
+	testWarning      = "test-warning"      // a test with severity warn failed
+	deprecatedConfig = "deprecated-config" // dbt_project.yml uses a deprecated setting
+	unusedYaml       = "unused-yaml"       // a property file describes a resource that doesn't exist
+)
+
+var warningKinds = []string{testWarning, deprecatedConfig, unusedYaml}
+
+// warnError holds which kinds of warnings are treated as errors.
+type warnError struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// parseWarnError reads --warn-error, which promotes all warnings, and --warn-error-options, which
+// selects the kinds of warnings, e.g. '{include: all, exclude: [unused-yaml]}' or '{include: [test-warning]}'.
+func (g *Graph) parseWarnError(cmd *cobra.Command) {
+	all, _ := cmd.Flags().GetBool("warn-error")
+	options, _ := cmd.Flags().GetString("warn-error-options")
+	warnError, err := newWarnError(all, options)
+	if err != nil {
+		log.Fatal(err)
+	}
+	g.warnError = warnError
+}
+
+func newWarnError(all bool, options string) (warnError, error) {
+	warnError := warnError{include: make(map[string]bool), exclude: make(map[string]bool)}
+	parsed := struct {
+		Include interface{}
+		Exclude []string
+	}{}
+	if options != "" {
+		err := yaml.Unmarshal([]byte(options), &parsed)
+		if err != nil {
+			return warnError, fmt.Errorf("Could not parse --warn-error-options, expected e.g. '{include: all, exclude: [unused-yaml]}': %v", err)
+		}
+	}
+
+	include := make([]string, 0)
+	switch value := parsed.Include.(type) {
+	case nil:
+	case string:
+		if value != "all" && value != "*" {
+			return warnError, fmt.Errorf("--warn-error-options: 'include' should be all or a list of warnings, got '%s'", value)
+		}
+		all = true
+	case []interface{}:
+		for _, kind := range value {
+			include = append(include, fmt.Sprint(kind))
+		}
+	default:
+		return warnError, fmt.Errorf("--warn-error-options: 'include' should be all or a list of warnings, got %v", value)
+	}
+	if all {
+		include = warningKinds
+	}
+
+	for _, kinds := range [][]string{include, parsed.Exclude} {
+		for _, kind := range kinds {
+			if !isWarningKind(kind) {
+				sorted := append([]string{}, warningKinds...)
+				sort.Strings(sorted)
+				return warnError, fmt.Errorf("--warn-error-options: unknown warning '%s', expected one of %s", kind, strings.Join(sorted, ", "))
+			}
+		}
+	}
+	for _, kind := range include {
+		warnError.include[kind] = true
+	}
+	for _, kind := range parsed.Exclude {
+		warnError.exclude[kind] = true
+	}
+	return warnError, nil
+}
+
+func isWarningKind(kind string) bool {
+	for _, known := range warningKinds {
+		if kind == known {
+			return true
+		}
+	}
+	return false
+}
+
+func (w warnError) promotes(kind string) bool {
+	return w.include[kind] && !w.exclude[kind]
+}
+
+// warn logs a warning, or returns it as an error when --warn-error promotes its kind.
+func (g *Graph) warn(kind string, message string) error {
+	if g.warnError.promotes(kind) {
+		return fmt.Errorf("Error (%s promoted by --warn-error): %s", kind, message)
+	}
+	log.Printf("Warning: %s", message)
+	return nil
+}
@@ -0,0 +1,31 @@
+package dbt
+
+import "testing"
+
+func TestWarnErrorOptionsSelectTheWarningsToPromote(t *testing.T) {
+	warnError, err := newWarnError(false, "{include: all, exclude: [unused-yaml]}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !warnError.promotes(testWarning) || !warnError.promotes(deprecatedConfig) || warnError.promotes(unusedYaml) {
+		t.Error(warnError)
+	}
+
+	warnError, err = newWarnError(false, `{"include": ["deprecated-config"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warnError.promotes(testWarning) || !warnError.promotes(deprecatedConfig) {
+		t.Error(warnError)
+	}
+
+	warnError, _ = newWarnError(true, "")
+	g := &Graph{warnError: warnError}
+	if err := g.warn(unusedYaml, "schema.yml describes model 'ghost' which does not exist"); err == nil {
+		t.Error("expected --warn-error to promote the warning")
+	}
+
+	if _, err := newWarnError(false, "{include: [typo]}"); err == nil {
+		t.Error("expected an unknown warning to fail")
+	}
+}
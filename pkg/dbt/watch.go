@@ -3,16 +3,18 @@ package dbt
 import (
 	"fmt"
 
+	"github.com/mdesmet/go-dbt/pkg/config"
 	"github.com/spf13/cobra"
 )
 
 func watchTask(cmd *cobra.Command, _ []string) {
-	fmt.Println(cmd.Flags().GetString("model"))
-	fmt.Println("----------------")
-	graph := createGraph()
+	model, err := cmd.Flags().GetString("model")
+	fmt.Fprintln(config.Stdout, model, err)
+	fmt.Fprintln(config.Stdout, "----------------")
+	graph := createGraph(cmd)
 	for _, node := range graph.Models {
-		fmt.Println(node.UniqueId)
-		fmt.Println(node.CompiledSql)
-		fmt.Println("----------------")
+		fmt.Fprintln(config.Stdout, node.UniqueId)
+		fmt.Fprintln(config.Stdout, node.CompiledSql)
+		fmt.Fprintln(config.Stdout, "----------------")
 	}
 }